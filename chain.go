@@ -0,0 +1,36 @@
+package dataloadgen
+
+// Chain composes two loaders through a key extraction function, so loading a
+// key of outer resolves to the inner value for the key extracted from the outer
+// value, such as loading the authors of posts by post ID. Keys are batched at
+// each level: a batch of outer keys is loaded from outer with LoadAll, and the
+// inner keys they lead to are loaded from inner as one batch. The returned
+// loader caches results per outer key and is configured with the options.
+func Chain[OuterKeyT comparable, OuterValueT any, InnerKeyT comparable, ValueT any](outer *Loader[OuterKeyT, OuterValueT], inner *Loader[InnerKeyT, ValueT], key func(OuterValueT) InnerKeyT, options ...Option) *Loader[OuterKeyT, ValueT] {
+	return NewLoader(func(keys []OuterKeyT) (map[OuterKeyT]ValueT, error) {
+		outerValues, outerErrs := outer.LoadAll(keys)
+
+		futures := make([]*Future[ValueT], len(keys))
+		for i, outerValue := range outerValues {
+			if outerErrs == nil || outerErrs[i] == nil {
+				futures[i] = inner.LoadFuture(key(outerValue))
+			}
+		}
+
+		results := make(map[OuterKeyT]ValueT, len(keys))
+		errs := make(ErrorMap[OuterKeyT])
+		for i, outerKey := range keys {
+			if futures[i] == nil {
+				errs[outerKey] = outerErrs[i]
+				continue
+			}
+			value, err := futures[i].Get()
+			if err != nil {
+				errs[outerKey] = err
+				continue
+			}
+			results[outerKey] = value
+		}
+		return results, errs
+	}, options...)
+}
@@ -0,0 +1,76 @@
+package dataloadgen_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	var mu sync.Mutex
+	var postFetches [][]int
+	posts := dataloadgen.NewLoader(func(keys []int) (map[int]post, error) {
+		mu.Lock()
+		postFetches = append(postFetches, keys)
+		mu.Unlock()
+		results := make(map[int]post, len(keys))
+		errs := make(dataloadgen.ErrorMap[int])
+		for _, key := range keys {
+			switch {
+			case key == 13:
+				errs[key] = errors.New("forbidden")
+			case key > 0:
+				results[key] = post{ID: key, AuthorID: fmt.Sprint("author ", key%3)}
+			}
+		}
+		return results, errs
+	}, dataloadgen.WithWait(time.Millisecond))
+
+	var authorFetches [][]string
+	authors := dataloadgen.NewLoader(func(keys []string) (map[string]string, error) {
+		mu.Lock()
+		authorFetches = append(authorFetches, keys)
+		mu.Unlock()
+		results := make(map[string]string, len(keys))
+		for _, key := range keys {
+			if key != "author 2" {
+				results[key] = "name of " + key
+			}
+		}
+		return results, nil
+	}, dataloadgen.WithWait(time.Millisecond))
+
+	postAuthors := dataloadgen.Chain(posts, authors, func(p post) string {
+		return p.AuthorID
+	}, dataloadgen.WithWait(time.Millisecond))
+
+	t.Run("batches each level", func(t *testing.T) {
+		names, errs := postAuthors.LoadAll([]int{1, 3, 4, 6})
+		require.Nil(t, errs)
+		require.Equal(t, []string{"name of author 1", "name of author 0", "name of author 1", "name of author 0"}, names)
+		require.Len(t, postFetches, 1)
+		require.Len(t, authorFetches, 1)
+		require.ElementsMatch(t, []string{"author 0", "author 1"}, authorFetches[0])
+	})
+
+	t.Run("caches per outer key", func(t *testing.T) {
+		name, err := postAuthors.Load(4)
+		require.NoError(t, err)
+		require.Equal(t, "name of author 1", name)
+		require.Len(t, postFetches, 1)
+		require.Len(t, authorFetches, 1)
+	})
+
+	t.Run("errors from either level", func(t *testing.T) {
+		_, errs := postAuthors.LoadAll([]int{13, -1, 2, 7})
+		require.EqualError(t, errs[0], "forbidden")
+		require.ErrorIs(t, errs[1], dataloadgen.ErrNotFound)
+		require.ErrorIs(t, errs[2], dataloadgen.ErrNotFound)
+		require.NoError(t, errs[3])
+	})
+}
@@ -0,0 +1,102 @@
+package dataloadgen
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// WithStrictFetch validates every fetch result against the keys of its batch.
+// If fetch returned keys that were not requested, left out keys without
+// returning an error for them, returned both a value and an error for a key, or
+// returned a nil map with a nil error, every key in the batch fails with the
+// *ContractViolation. This is meant to be enabled in tests to catch broken
+// queries, since a fetch that leaves out keys is otherwise indistinguishable
+// from records that don't exist.
+func WithStrictFetch() Option {
+	return func(l *loaderConfig) {
+		l.strict = true
+	}
+}
+
+// SetContractViolationHook validates every fetch result against the keys of
+// its batch like WithStrictFetch, but reports violations to hook instead of
+// failing the batch, unless WithStrictFetch is also used.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) SetContractViolationHook(hook func(*ContractViolation[CacheKeyT])) {
+	l.onViolation = hook
+}
+
+// ContractViolation describes how a fetch result did not match the keys of the
+// batch it was called with
+type ContractViolation[CacheKeyT comparable] struct {
+	// Extra are keys fetch returned a value or an error for that were not requested
+	Extra []CacheKeyT
+	// Missing are requested keys fetch returned neither a value nor an error for
+	Missing []CacheKeyT
+	// Duplicate are keys fetch returned both a value and an error for
+	Duplicate []CacheKeyT
+	// NilResult is set if fetch returned a nil map and a nil error
+	NilResult bool
+}
+
+func (v *ContractViolation[CacheKeyT]) Error() string {
+	var problems []string
+	if v.NilResult {
+		problems = append(problems, "nil result without an error")
+	}
+	if len(v.Extra) > 0 {
+		problems = append(problems, fmt.Sprintf("unrequested keys %v", v.Extra))
+	}
+	if len(v.Missing) > 0 {
+		problems = append(problems, fmt.Sprintf("missing keys %v", v.Missing))
+	}
+	if len(v.Duplicate) > 0 {
+		problems = append(problems, fmt.Sprintf("keys with both a value and an error %v", v.Duplicate))
+	}
+	return "dataloadgen: fetch returned " + strings.Join(problems, ", ")
+}
+
+// checkContract compares a fetch result with the batch entries it was called for and
+// returns the violations, or nil if there are none
+func checkContract[CacheKeyT comparable, ValueT any](entries []batchEntry[CacheKeyT, ValueT], data map[CacheKeyT]ValueT, err error) *ContractViolation[CacheKeyT] {
+	var em ErrorMap[CacheKeyT]
+	isErrorMap := err != nil && errors.As(err, &em)
+	if err != nil && !isErrorMap {
+		// a single error for the whole batch accounts for every key
+		return nil
+	}
+
+	violation := &ContractViolation[CacheKeyT]{
+		NilResult: data == nil && err == nil,
+	}
+	requested := make(map[CacheKeyT]struct{}, len(entries))
+	for _, e := range entries {
+		key := e.cacheKey
+		requested[key] = struct{}{}
+		_, hasValue := data[key]
+		_, hasError := em[key]
+		switch {
+		case hasValue && hasError:
+			violation.Duplicate = append(violation.Duplicate, key)
+		case !hasValue && !hasError:
+			violation.Missing = append(violation.Missing, key)
+		}
+	}
+	for key := range data {
+		if _, ok := requested[key]; !ok {
+			violation.Extra = append(violation.Extra, key)
+		}
+	}
+	for key := range em {
+		if _, ok := requested[key]; !ok {
+			if _, ok := data[key]; !ok {
+				violation.Extra = append(violation.Extra, key)
+			}
+		}
+	}
+
+	if !violation.NilResult && violation.Extra == nil && violation.Missing == nil && violation.Duplicate == nil {
+		return nil
+	}
+	return violation
+}
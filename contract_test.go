@@ -0,0 +1,75 @@
+package dataloadgen_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContractViolations(t *testing.T) {
+	// 1 resolves, 2 is left out, 3 has both a value and an error and 4 was never requested
+	brokenFetch := func(keys []int) (map[int]string, error) {
+		return map[int]string{1: "one", 3: "three", 4: "four"}, dataloadgen.ErrorMap[int]{3: errors.New("three")}
+	}
+
+	t.Run("hook", func(t *testing.T) {
+		var violations []*dataloadgen.ContractViolation[int]
+		dl := dataloadgen.NewLoader(brokenFetch, dataloadgen.WithWait(time.Millisecond))
+		dl.SetContractViolationHook(func(v *dataloadgen.ContractViolation[int]) {
+			violations = append(violations, v)
+		})
+		values, errs := dl.LoadAll([]int{1, 2, 3})
+		require.Equal(t, "one", values[0])
+		require.NoError(t, errs[0])
+		require.ErrorIs(t, errs[1], dataloadgen.ErrNotFound)
+
+		require.Len(t, violations, 1)
+		require.Equal(t, []int{4}, violations[0].Extra)
+		require.Equal(t, []int{2}, violations[0].Missing)
+		require.Equal(t, []int{3}, violations[0].Duplicate)
+		require.False(t, violations[0].NilResult)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		dl := dataloadgen.NewLoader(brokenFetch,
+			dataloadgen.WithWait(time.Millisecond),
+			dataloadgen.WithStrictFetch(),
+		)
+		_, errs := dl.LoadAll([]int{1, 2, 3})
+		for _, err := range errs {
+			var violation *dataloadgen.ContractViolation[int]
+			require.ErrorAs(t, err, &violation)
+		}
+		require.EqualError(t, errs[0], "dataloadgen: fetch returned unrequested keys [4], missing keys [2], keys with both a value and an error [3]")
+	})
+
+	t.Run("nil result", func(t *testing.T) {
+		dl := dataloadgen.NewLoader(func(keys []int) (map[int]string, error) {
+			return nil, nil
+		},
+			dataloadgen.WithWait(time.Millisecond),
+			dataloadgen.WithStrictFetch(),
+		)
+		_, err := dl.Load(1)
+		var violation *dataloadgen.ContractViolation[int]
+		require.ErrorAs(t, err, &violation)
+		require.True(t, violation.NilResult)
+		require.Equal(t, []int{1}, violation.Missing)
+	})
+
+	t.Run("valid results", func(t *testing.T) {
+		dl := dataloadgen.NewLoader(func(keys []int) (map[int]string, error) {
+			return map[int]string{1: "one"}, dataloadgen.ErrorMap[int]{2: errors.New("two")}
+		},
+			dataloadgen.WithWait(time.Millisecond),
+			dataloadgen.WithStrictFetch(),
+		)
+		values, errs := dl.LoadAll([]int{1, 2})
+		require.Equal(t, "one", values[0])
+		require.NoError(t, errs[0])
+		require.EqualError(t, errs[1], "two")
+	})
+}
@@ -1,6 +1,7 @@
 package dataloadgen_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -605,3 +606,24 @@ func FaultyLoader() (*dataloadgen.Loader[string, string], *[][]string) {
 
 	return loader, &loadCalls
 }
+
+// RecordingLoader returns a loader fetching with fetch, and a function
+// returning the batches of keys it fetched so far. fetch is passed the number
+// of the call, starting at 1.
+func RecordingLoader[KeyT comparable, ValueT any](fetch func(ctx context.Context, call int, keys []KeyT) (map[KeyT]ValueT, error), options ...dataloadgen.Option) (*dataloadgen.Loader[KeyT, ValueT], func() [][]KeyT) {
+	var mu sync.Mutex
+	var loadCalls [][]KeyT
+	loader := dataloadgen.NewLoaderContext(func(ctx context.Context, keys []KeyT) (map[KeyT]ValueT, error) {
+		mu.Lock()
+		// fetch may sort or rewrite its keys in place
+		loadCalls = append(loadCalls, append([]KeyT(nil), keys...))
+		call := len(loadCalls)
+		mu.Unlock()
+		return fetch(ctx, call, keys)
+	}, options...)
+	return loader, func() [][]KeyT {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([][]KeyT(nil), loadCalls...)
+	}
+}
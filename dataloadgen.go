@@ -1,9 +1,13 @@
 package dataloadgen
 
 import (
+	"context"
 	"errors"
+	"hash/maphash"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 )
 
 // Option allows for configuration of loader fields.
@@ -24,21 +28,103 @@ func WithWait(d time.Duration) Option {
 	}
 }
 
+// WithShards partitions the cache and the bookkeeping of pending keys across n
+// stripes by key hash, so goroutines loading different keys rarely contend on
+// the same lock. Keys from all stripes are still coalesced into shared batches
+// for fetch, but the order of keys within a batch is only preserved per stripe.
+// Default is 1 (unsharded)
+func WithShards(n int) Option {
+	return func(l *loaderConfig) {
+		l.shards = n
+	}
+}
+
+// WithNotFoundZero makes keys that fetch returned no value for resolve to the
+// zero ValueT and a nil error, instead of a NotFoundError.
+func WithNotFoundZero() Option {
+	return func(l *loaderConfig) {
+		l.notFoundZero = true
+	}
+}
+
+// WithoutCache stops the loader from caching results, so every load of a key
+// that isn't part of a pending batch fetches it again. Keys loaded while the
+// same batch is pending are still deduplicated. This is meant for process-wide
+// loaders that only merge the batches of per-request loaders, see
+// NewTieredLoader.
+func WithoutCache() Option {
+	return func(l *loaderConfig) {
+		l.noCache = true
+	}
+}
+
+// WithPartialResults makes keys that fetch returned a value for succeed even if
+// fetch also returned an error that isn't an ErrorMap, such as when one shard
+// of a database failed. Only the keys without a value get the error. By default
+// every key of the batch gets the error.
+func WithPartialResults() Option {
+	return func(l *loaderConfig) {
+		l.partialResults = true
+	}
+}
+
 // NewLoader creates a new GenericLoader given a fetch, wait, and maxBatch
 func NewLoader[KeyT comparable, ValueT any](fetch func(keys []KeyT) (map[KeyT]ValueT, error), options ...Option) *Loader[KeyT, ValueT] {
+	return &Loader[KeyT, ValueT]{
+		KeyedLoader: NewKeyedLoader(fetch, func(key KeyT) KeyT { return key }, options...),
+	}
+}
+
+// NewKeyedLoader creates a new KeyedLoader given a fetch and a keyFunc. keyFunc
+// derives the comparable cache key used to deduplicate and cache each key, so
+// KeyT can be a slice, a struct containing slices or a value with a canonical
+// form (such as a case-insensitive email). fetch receives the original keys and
+// returns its results keyed by the derived cache key.
+func NewKeyedLoader[KeyT any, CacheKeyT comparable, ValueT any](fetch func(keys []KeyT) (map[CacheKeyT]ValueT, error), keyFunc func(KeyT) CacheKeyT, options ...Option) *KeyedLoader[KeyT, CacheKeyT, ValueT] {
+	return NewKeyedLoaderContext(func(ctx context.Context, keys []KeyT) (map[CacheKeyT]ValueT, error) {
+		return fetch(keys)
+	}, keyFunc, options...)
+}
+
+// NewLoaderContext creates a new Loader like NewLoader, given a fetch that
+// receives the context of the batch. The context is cancelled when the batch
+// times out (see WithFetchTimeout).
+func NewLoaderContext[KeyT comparable, ValueT any](fetch FetchFunc[KeyT, KeyT, ValueT], options ...Option) *Loader[KeyT, ValueT] {
+	return &Loader[KeyT, ValueT]{
+		KeyedLoader: NewKeyedLoaderContext(fetch, func(key KeyT) KeyT { return key }, options...),
+	}
+}
+
+// NewKeyedLoaderContext creates a new KeyedLoader like NewKeyedLoader, given a
+// fetch that receives the context of the batch.
+func NewKeyedLoaderContext[KeyT any, CacheKeyT comparable, ValueT any](fetch FetchFunc[KeyT, CacheKeyT, ValueT], keyFunc func(KeyT) CacheKeyT, options ...Option) *KeyedLoader[KeyT, CacheKeyT, ValueT] {
+	config := newLoaderConfig(options)
+	return &KeyedLoader[KeyT, CacheKeyT, ValueT]{
+		fetch:        fetch,
+		unwrapped:    fetch,
+		keyFunc:      keyFunc,
+		notFound:     notFoundFunc[KeyT, ValueT](config.notFoundZero),
+		batches:      map[any]*loaderBatch[KeyT, CacheKeyT, ValueT]{},
+		loaderConfig: config,
+		shards:       make([]loaderShard[KeyT, CacheKeyT, ValueT], config.shards),
+		seed:         maphash.MakeSeed(),
+	}
+}
+
+// newLoaderConfig applies the options to the default configuration
+func newLoaderConfig(options []Option) *loaderConfig {
 	config := &loaderConfig{
 		wait:     16 * time.Millisecond,
 		maxBatch: 0, //unlimited
+		shards:   1,
 	}
 	for _, o := range options {
 		o(config)
 	}
-	l := &Loader[KeyT, ValueT]{
-		fetch:        fetch,
-		loaderConfig: config,
-		cache:        map[KeyT]func() (ValueT, error){},
+	if config.shards < 1 {
+		config.shards = 1
 	}
-	return l
+	return config
 }
 
 type loaderConfig struct {
@@ -47,189 +133,892 @@ type loaderConfig struct {
 
 	// this will limit the maximum number of keys to send in one batch, 0 = no limit
 	maxBatch int
+
+	// this will limit the summed weight of the keys in one batch, 0 = no limit
+	maxWeight int
+
+	// the number of stripes the cache and pending keys are partitioned across
+	shards int
+
+	// don't cache results, only deduplicate keys of pending batches
+	noCache bool
+
+	// keys with a value succeed even if fetch returned an error
+	partialResults bool
+
+	// keys missing from the fetch result resolve to the zero ValueT instead of
+	// a NotFoundError
+	notFoundZero bool
+
+	// validate fetch results against the keys of the batch, failing every key
+	// in the batch if they don't match
+	strict bool
+
+	// how long a fetch may take before its batch fails, 0 = no limit
+	fetchTimeout time.Duration
+
+	// cache the results of fetches that completed after timing out
+	lateResults bool
+
+	// how long results that resolved to ErrNotFound stay cached and how many
+	// of them are cached at once, 0 = no limit
+	negativeTTL time.Duration
+	maxNegative int
+
+	// how long to wait for a fetch before issuing a second one, or the
+	// percentile of recent fetch durations to wait for, 0 = no hedging
+	hedgeDelay      time.Duration
+	hedgePercentile float64
+}
+
+// notFoundFunc returns the function missing keys resolve to unless
+// SetNotFoundFunc is used
+func notFoundFunc[KeyT, ValueT any](zero bool) func(KeyT) (ValueT, error) {
+	if zero {
+		return func(key KeyT) (ValueT, error) {
+			var zero ValueT
+			return zero, nil
+		}
+	}
+	return func(key KeyT) (ValueT, error) {
+		var zero ValueT
+		return zero, &NotFoundError[KeyT]{Key: key}
+	}
 }
 
 // Loader batches and caches requests
 type Loader[KeyT comparable, ValueT any] struct {
-	// this method provides the data for the loader
-	fetch func(keys []KeyT) (map[KeyT]ValueT, error)
+	*KeyedLoader[KeyT, KeyT, ValueT]
+}
+
+// KeyedLoader batches and caches requests, deduplicating and caching them by
+// a cache key derived from each key.
+//
+// Settings that depend on the key and value types, such as SetNotFoundFunc,
+// are methods rather than Options so they are type checked. They must be called
+// before the loader is first used.
+type KeyedLoader[KeyT any, CacheKeyT comparable, ValueT any] struct {
+	// this method provides the data for the loader, wrapped in middleware
+	fetch FetchFunc[KeyT, CacheKeyT, ValueT]
+
+	// the fetch the loader was created with, before middleware
+	unwrapped FetchFunc[KeyT, CacheKeyT, ValueT]
+
+	// this method derives the cache key of a key
+	keyFunc func(KeyT) CacheKeyT
+
+	// this method provides the result for keys missing from the fetch result
+	notFound func(KeyT) (ValueT, error)
+
+	// this method is called when a fetch result breaks the fetch contract
+	onViolation func(*ContractViolation[CacheKeyT])
+
+	// this method returns the partition of a key, keys are only batched with
+	// keys of the same partition
+	partition func(KeyT) any
+
+	// this method returns the weight of a key for WithMaxBatchWeight
+	weight func(KeyT) int
+
+	// the bus that cleared keys are published to, and the method that stops
+	// listening to it
+	bus         Bus[CacheKeyT]
+	unsubscribe func()
 
 	*loaderConfig
 
 	// INTERNAL
 
-	// lazily created cache
-	cache map[KeyT]func() (ValueT, error)
+	// the cache and the keys added to the current batch, partitioned by key hash
+	shards []loaderShard[KeyT, CacheKeyT, ValueT]
+
+	// seed used to hash cache keys to shards
+	seed maphash.Seed
+
+	// the current batch of each partition. keys will continue to be collected
+	// until timeout is hit, then everything will be sent to the fetch method and
+	// out to the listeners
+	batches map[any]*loaderBatch[KeyT, CacheKeyT, ValueT]
+
+	// the configuration of partitions with their own options
+	partitions map[any]*loaderConfig
+
+	// the cached results that resolved to ErrNotFound
+	negatives negativeCache[CacheKeyT, ValueT]
+
+	// resolve keys independently as fetch emits them, see NewStreamLoader
+	streaming bool
+
+	// the counters and fetch durations of hedged fetches
+	hedges hedgeState
+
+	// mutex to prevent races on batches
+	mu sync.Mutex
+}
+
+type loaderShard[KeyT any, CacheKeyT comparable, ValueT any] struct {
+	// the cache, a map[CacheKeyT]*cacheEntry[ValueT] that is never written once
+	// published, so cache hits read it without locking
+	read atomic.Value
+
+	// lazily created copy of read with the keys added since it was published,
+	// and the number of loads that had to look there. once those loads
+	// outnumber its keys, it is published in place of read
+	dirty  map[CacheKeyT]*cacheEntry[ValueT]
+	misses int
+
+	// cache entries are allocated in chunks rather than one per key
+	entries []cacheEntry[ValueT]
 
-	// the current batch. keys will continue to be collected until timeout is hit,
-	// then everything will be sent to the fetch method and out to the listeners
-	batch *loaderBatch[KeyT, ValueT]
+	// the keys this shard has added to the current batch of each partition
+	pending map[any]*shardBatch[KeyT, CacheKeyT, ValueT]
+
+	// results are allocated in chunks rather than one per key
+	slots []Future[ValueT]
+
+	// a flushed shardBatch, reused for the next batch
+	spare *shardBatch[KeyT, CacheKeyT, ValueT]
 
 	// mutex to prevent races
 	mu sync.Mutex
 }
 
-type loaderBatch[KeyT comparable, ValueT any] struct {
+// cacheEntry holds the cached result of a key. Entries are shared by the read
+// and dirty maps of a shard, so evicting a key only needs to clear its entry.
+type cacheEntry[ValueT any] struct {
+	// the *Future[ValueT] of the key, nil once it was evicted
+	result unsafe.Pointer
+}
+
+// shardBatch holds the keys a shard has added to a batch and their results.
+// they are moved into the batch when it is dispatched
+type shardBatch[KeyT any, CacheKeyT comparable, ValueT any] struct {
+	batch   *loaderBatch[KeyT, CacheKeyT, ValueT]
 	keys    []KeyT
-	data    map[KeyT]ValueT
-	error   error
-	closing bool
+	entries []batchEntry[CacheKeyT, ValueT]
+
+	// the position of every key, created on first use. keys only need to be
+	// looked up without a cache, or once a pending key was cleared from it,
+	// since the cache already deduplicates them otherwise
+	index   map[CacheKeyT]int
+	cleared bool
+}
+
+type loaderBatch[KeyT any, CacheKeyT comparable, ValueT any] struct {
+	// the partition of the keys and its configuration
+	partition any
+	config    *loaderConfig
+
+	// the results already emitted by a streaming fetch, see NewStreamLoader
+	stream *streamBatch[KeyT, CacheKeyT, ValueT]
+
+	keys    []KeyT
+	entries []batchEntry[CacheKeyT, ValueT]
 	done    chan struct{}
+
+	// the number of keys added to the batch across all shards, and their weight
+	size   int32
+	weight int64
+	// set once the batch is dispatched, after which no more keys may be added
+	closing int32
+
+	// mutex to prevent races on keys while shards are flushed into the batch
+	mu sync.Mutex
+}
+
+// batchEntry is the cache key and the result of a key added to a batch
+type batchEntry[CacheKeyT comparable, ValueT any] struct {
+	cacheKey CacheKeyT
+	result   *Future[ValueT]
+}
+
+// SetNotFoundFunc makes keys that fetch returned no value for resolve to the
+// result of calling fn with the key, instead of a NotFoundError
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) SetNotFoundFunc(fn func(key KeyT) (ValueT, error)) {
+	l.notFound = fn
 }
 
 // Load a ValueT by key, batching and caching will be applied automatically
-func (l *Loader[KeyT, ValueT]) Load(key KeyT) (ValueT, error) {
-	return l.LoadThunk(key)()
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) Load(key KeyT) (ValueT, error) {
+	return l.load(key).Get()
 }
 
 // LoadThunk returns a function that when called will block waiting for a ValueT.
 // This method should be used if you want one goroutine to make requests to many
 // different data loaders without blocking until the thunk is called.
-func (l *Loader[KeyT, ValueT]) LoadThunk(key KeyT) func() (ValueT, error) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if it, ok := l.cache[key]; ok {
-		return it
-	}
-	if l.batch == nil {
-		l.batch = &loaderBatch[KeyT, ValueT]{done: make(chan struct{})}
-	}
-	batch := l.batch
-	batch.keyIndex(l, key)
-
-	thunk := func() (ValueT, error) {
-		<-batch.done
-
-		var data ValueT
-		var ok bool
-
-		var err error
-		if batch.error != nil {
-			var em ErrorMap[KeyT]
-			if ok := errors.As(batch.error, &em); ok {
-				if em == nil || len(em) == 0 {
-					err = nil
-				} else if specificError, ok := em[key]; ok {
-					err = specificError
-				}
-			} else {
-				err = batch.error
-			}
-		}
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) LoadThunk(key KeyT) func() (ValueT, error) {
+	return l.load(key).Get
+}
 
-		data, ok = batch.data[key]
-		if err == nil && !ok {
-			return data, ErrNotFound
-		}
+// LoadFuture returns a Future for the ValueT. Like LoadThunk it does not block,
+// and the Future can be composed with futures from other loaders using Then,
+// Map and All.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) LoadFuture(key KeyT) *Future[ValueT] {
+	return l.load(key)
+}
 
-		return data, err
+// load returns the future for the key, adding the key to a batch if it is not
+// cached yet
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) load(key KeyT) *Future[ValueT] {
+	cacheKey := l.keyFunc(key)
+	s := l.shard(cacheKey)
+	if l.noCache {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.keyIndex(l, key, cacheKey)
+	}
+	if r, ok := s.cached(cacheKey); ok && !l.expired(r) {
+		return r
 	}
-	l.cache[key] = thunk
-	return thunk
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// another goroutine may have added the key while we were waiting for the lock
+	if r, ok := s.load(cacheKey); ok && !l.expired(r) {
+		return r
+	}
+	r := s.keyIndex(l, key, cacheKey)
+	s.store(cacheKey, r)
+	return r
 }
 
-// LoadAll fetches many keys at once. It will be broken into appropriate sized
-// sub batches depending on how the loader is configured
-func (l *Loader[KeyT, ValueT]) LoadAll(keys []KeyT) ([]ValueT, []error) {
-	results := make([]func() (ValueT, error), len(keys))
-
-	for i, key := range keys {
-		results[i] = l.LoadThunk(key)
-	}
+// LoadAll fetches many keys at once. Keys that are cached or part of a pending
+// batch are shared with it, the others are sent to fetch right away instead of
+// waiting for more keys. They will be broken into appropriate sized sub batches
+// depending on how the loader is configured, which are fetched in parallel.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) LoadAll(keys []KeyT) ([]ValueT, []error) {
+	results := l.loadAll(keys)
 
 	values := make([]ValueT, len(keys))
-	errors := make([]error, len(keys))
-	allNil := true
-	for i, thunk := range results {
-		values[i], errors[i] = thunk()
-		if errors[i] != nil {
-			allNil = false
+	var errors []error
+	for i, r := range results {
+		var err error
+		values[i], err = r.Get()
+		if err != nil && errors == nil {
+			errors = make([]error, len(keys))
+		}
+		if errors != nil {
+			errors[i] = err
 		}
-	}
-	if allNil {
-		return values, nil
 	}
 	return values, errors
 }
 
 // LoadAllThunk returns a function that when called will block waiting for a ValueT.
 // This method should be used if you want one goroutine to make requests to many
-// different data loaders without blocking until the thunk is called.
-func (l *Loader[KeyT, ValueT]) LoadAllThunk(keys []KeyT) func() ([]ValueT, []error) {
-	results := make([]func() (ValueT, error), len(keys))
+// different data loaders without blocking until the thunk is called. Unlike
+// LoadAll, keys are batched with the keys loaded within the same wait.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) LoadAllThunk(keys []KeyT) func() ([]ValueT, []error) {
+	results := make([]*Future[ValueT], len(keys))
 	for i, key := range keys {
-		results[i] = l.LoadThunk(key)
+		results[i] = l.load(key)
 	}
 	return func() ([]ValueT, []error) {
 		values := make([]ValueT, len(keys))
 		errors := make([]error, len(keys))
-		for i, thunk := range results {
-			values[i], errors[i] = thunk()
+		for i, r := range results {
+			values[i], errors[i] = r.Get()
 		}
 		return values, errors
 	}
 }
 
+// loadAll returns the futures for the keys. Keys that are neither cached nor
+// part of a pending batch are added to batches of their own, which are
+// dispatched as soon as they are full and once every key has been added.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) loadAll(keys []KeyT) []*Future[ValueT] {
+	results := make([]*Future[ValueT], len(keys))
+	var batches map[any]*loaderBatch[KeyT, CacheKeyT, ValueT]
+	// without a cache, keys repeated in keys are deduplicated here instead
+	var loaded map[CacheKeyT]*Future[ValueT]
+
+	for i, key := range keys {
+		cacheKey := l.keyFunc(key)
+		s := l.shard(cacheKey)
+		if !l.noCache {
+			if r, ok := s.cached(cacheKey); ok && !l.expired(r) {
+				results[i] = r
+				continue
+			}
+		} else if r, ok := loaded[cacheKey]; ok {
+			results[i] = r
+			continue
+		}
+
+		var partition any
+		if l.partition != nil {
+			partition = l.partition(key)
+		}
+		s.mu.Lock()
+		if r, ok := s.pendingResult(l, partition, cacheKey); ok {
+			results[i] = r
+			s.mu.Unlock()
+			continue
+		}
+
+		b := batches[partition]
+		var keyWeight int64
+		if b == nil {
+			b = l.newBatch(partition)
+			if batches == nil {
+				batches = map[any]*loaderBatch[KeyT, CacheKeyT, ValueT]{}
+			}
+			batches[partition] = b
+		}
+		if b.config.maxWeight != 0 {
+			keyWeight = int64(l.keyWeight(key))
+		}
+		if len(b.keys) > 0 && ((b.config.maxBatch != 0 && len(b.keys) >= b.config.maxBatch) ||
+			(b.config.maxWeight != 0 && b.weight+keyWeight > int64(b.config.maxWeight))) {
+			go l.dispatch(b)
+			b = l.newBatch(partition)
+			batches[partition] = b
+		}
+		b.weight += keyWeight
+
+		r := s.slot(l.resultDone(b))
+		b.keys = append(b.keys, key)
+		b.entries = append(b.entries, batchEntry[CacheKeyT, ValueT]{cacheKey: cacheKey, result: r})
+		if l.noCache {
+			if loaded == nil {
+				loaded = map[CacheKeyT]*Future[ValueT]{}
+			}
+			loaded[cacheKey] = r
+		} else {
+			s.store(cacheKey, r)
+		}
+		s.mu.Unlock()
+		results[i] = r
+	}
+
+	for _, b := range batches {
+		go l.dispatch(b)
+	}
+	return results
+}
+
 // Prime the cache with the provided key and value. If the key already exists, no change is made
-// and false is returned.
-// (To forcefully prime the cache, clear the key first with loader.Clear(key).Prime(key, value).)
-func (l *Loader[KeyT, ValueT]) Prime(key KeyT, value ValueT) bool {
+// and false is returned. To overwrite the value of a key use Set.
+// Loaders created WithoutCache can't be primed.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) Prime(key KeyT, value ValueT) bool {
+	return l.prime(l.keyFunc(key), &Future[ValueT]{value: value, done: closed}, false)
+}
+
+// PrimeError primes the cache with an error for the provided key, such as a
+// known permission failure, so loads of the key fail without calling fetch. If
+// the key already exists, no change is made and false is returned.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) PrimeError(key KeyT, err error) bool {
+	return l.prime(l.keyFunc(key), &Future[ValueT]{err: err, done: closed}, false)
+}
+
+// Set the value of the key in the cache, overwriting any existing value. If the
+// key is part of a pending batch, callers already waiting for it still receive
+// the fetched result, but later loads get the value that was set.
+// Loaders created WithoutCache ignore Set.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) Set(key KeyT, value ValueT) {
+	l.prime(l.keyFunc(key), &Future[ValueT]{value: value, done: closed}, true)
+}
+
+// PrimeMany primes the cache with the provided values by cache key, while
+// holding the lock of every shard so loads observe either none or all of them.
+// Keys that already exist are left unchanged. It returns the number of keys
+// that were primed.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) PrimeMany(values map[CacheKeyT]ValueT) int {
+	if l.noCache {
+		return 0
+	}
+	for i := range l.shards {
+		l.shards[i].mu.Lock()
+	}
+	var primed int
+	for cacheKey, value := range values {
+		s := l.shard(cacheKey)
+		if _, found := s.load(cacheKey); !found {
+			s.store(cacheKey, &Future[ValueT]{value: value, done: closed})
+			primed++
+		}
+	}
+	for i := range l.shards {
+		l.shards[i].mu.Unlock()
+	}
+	return primed
+}
+
+// prime stores the resolved future in the cache, unless the cache key exists
+// and overwrite is false. It reports whether the future was stored.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) prime(cacheKey CacheKeyT, r *Future[ValueT], overwrite bool) bool {
+	if l.noCache {
+		return false
+	}
+	s := l.shard(cacheKey)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !overwrite {
+		if _, found := s.load(cacheKey); found {
+			return false
+		}
+	}
+	s.store(cacheKey, r)
+	return true
+}
+
+// Clear the value at key from the cache, if it exists. If the loader has an
+// invalidation bus, the key is cleared from the loaders subscribed to it too.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) Clear(key KeyT) {
+	cacheKey := l.keyFunc(key)
+	l.evict(cacheKey)
+	if l.bus != nil {
+		l.bus.Publish(Invalidation[CacheKeyT]{Keys: []CacheKeyT{cacheKey}})
+	}
+}
+
+// ClearAll clears every value from the cache. If the loader has an
+// invalidation bus, the loaders subscribed to it are cleared too.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) ClearAll() {
+	l.evictAll()
+	if l.bus != nil {
+		l.bus.Publish(Invalidation[CacheKeyT]{All: true})
+	}
+}
+
+// evict clears the value at the cache key from the cache
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) evict(cacheKey CacheKeyT) {
+	s := l.shard(cacheKey)
+	s.mu.Lock()
+	if r, ok := s.load(cacheKey); ok && !r.Ready() {
+		s.clearedPending()
+	}
+	s.delete(cacheKey)
+	s.mu.Unlock()
+}
+
+// evictAll clears every value from the cache
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) evictAll() {
+	for i := range l.shards {
+		s := &l.shards[i]
+		s.mu.Lock()
+		s.clear()
+		s.clearedPending()
+		s.mu.Unlock()
+	}
+}
+
+// shard returns the shard responsible for the cache key
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) shard(cacheKey CacheKeyT) *loaderShard[KeyT, CacheKeyT, ValueT] {
+	if len(l.shards) == 1 {
+		return &l.shards[0]
+	}
+	return &l.shards[hashKey(l.seed, cacheKey)%uint64(len(l.shards))]
+}
+
+// pendingBatch returns the batch keys of the partition are currently being added
+// to, starting a new one if there is none
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) pendingBatch(partition any) *loaderBatch[KeyT, CacheKeyT, ValueT] {
 	l.mu.Lock()
-	var found bool
-	if _, found = l.cache[key]; !found {
-		l.cache[key] = func() (ValueT, error) { return value, nil }
+	defer l.mu.Unlock()
+	if b, ok := l.batches[partition]; ok {
+		return b
+	}
+	b := l.newBatch(partition)
+	l.batches[partition] = b
+	go func() {
+		time.Sleep(b.config.wait)
+		l.dispatch(b)
+	}()
+	return b
+}
+
+// newBatch creates an empty batch for keys of the partition
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) newBatch(partition any) *loaderBatch[KeyT, CacheKeyT, ValueT] {
+	config, ok := l.partitions[partition]
+	if !ok {
+		config = l.loaderConfig
+	}
+	return &loaderBatch[KeyT, CacheKeyT, ValueT]{
+		partition: partition,
+		config:    config,
+		done:      make(chan struct{}),
 	}
-	l.mu.Unlock()
-	return !found
 }
 
-// Clear the value at key from the cache, if it exists
-func (l *Loader[KeyT, ValueT]) Clear(key KeyT) {
+// retire stops new keys from being added to the batch
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) retire(b *loaderBatch[KeyT, CacheKeyT, ValueT]) {
 	l.mu.Lock()
-	delete(l.cache, key)
+	if l.batches[b.partition] == b {
+		delete(l.batches, b.partition)
+	}
 	l.mu.Unlock()
 }
 
-// keyIndex will return the location of the key in the batch, if its not found
-// it will add the key to the batch
-func (b *loaderBatch[KeyT, ValueT]) keyIndex(l *Loader[KeyT, ValueT], key KeyT) {
-	for _, existingKey := range b.keys {
-		if key == existingKey {
-			return
+// dispatch collects the keys every shard added to the batch and sends them to
+// the fetch method. Only the first call for a batch has any effect.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) dispatch(b *loaderBatch[KeyT, CacheKeyT, ValueT]) {
+	// we must have hit a batch limit and are already finalizing this batch
+	if !atomic.CompareAndSwapInt32(&b.closing, 0, 1) {
+		return
+	}
+	l.retire(b)
+
+	// shards check closing while holding their lock, so once a shard has been
+	// visited here it can no longer add keys to this batch
+	for i := range l.shards {
+		s := &l.shards[i]
+		s.mu.Lock()
+		if sb := s.pending[b.partition]; sb != nil && sb.batch == b {
+			s.flush(sb)
 		}
+		s.mu.Unlock()
 	}
 
-	pos := len(b.keys)
-	b.keys = append(b.keys, key)
-	if pos == 0 {
-		go func(l *Loader[KeyT, ValueT]) {
-			time.Sleep(l.wait)
-			l.mu.Lock()
+	if l.streaming {
+		b.stream = newStreamBatch(b)
+	}
+	if l.fetchTimeout > 0 {
+		l.fetchWithTimeout(b)
+		return
+	}
+	data, err := l.fetchBatch(l.batchContext(b), b)
+	l.complete(b, data, err)
+}
 
-			// we must have hit a batch limit and are already finalizing this batch
-			if b.closing {
-				l.mu.Unlock()
-				return
+// complete resolves the batch with the fetch output and wakes up its waiters
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) complete(b *loaderBatch[KeyT, CacheKeyT, ValueT], data map[CacheKeyT]ValueT, err error) {
+	if l.strict || l.onViolation != nil {
+		if violation := checkContract(b.entries, data, err); violation != nil {
+			if l.onViolation != nil {
+				l.onViolation(violation)
 			}
+			if l.strict {
+				data, err = nil, violation
+			}
+		}
+	}
+	if b.stream != nil {
+		b.stream.complete(l, data, err)
+	} else {
+		b.resolve(l, b.entries, nil, data, err)
+	}
+	close(b.done)
+	l.trackNegatives(b.entries)
+}
 
-			l.batch = nil
-			l.mu.Unlock()
+// resolve sets the results of entries, one for every key in the batch, from the
+// fetch output. Results of keys that are marked in skip were already resolved
+// and are left alone.
+func (b *loaderBatch[KeyT, CacheKeyT, ValueT]) resolve(l *KeyedLoader[KeyT, CacheKeyT, ValueT], entries []batchEntry[CacheKeyT, ValueT], skip []bool, data map[CacheKeyT]ValueT, err error) {
+	var em ErrorMap[CacheKeyT]
+	var isErrorMap bool
+	if err != nil {
+		em, isErrorMap = asErrorMap[CacheKeyT](err)
+	}
+	var expires int64
+	for i, e := range entries {
+		if skip != nil && skip[i] {
+			continue
+		}
+		cacheKey, r := e.cacheKey, e.result
+		var ok bool
+		r.value, ok = data[cacheKey]
+		switch {
+		case isErrorMap:
+			r.err = em[cacheKey]
+		case err != nil && !(ok && l.partialResults):
+			r.err = err
+		}
+		if r.err == nil && !ok {
+			r.value, r.err = l.notFound(b.keys[i])
+		}
+		if l.negativeTTL > 0 && isNegative(r.err) {
+			if expires == 0 {
+				expires = time.Now().Add(l.negativeTTL).UnixNano()
+			}
+			r.expires = expires
+		}
+	}
+}
+
+// asErrorMap returns the ErrorMap in the chain of err, if there is one
+func asErrorMap[CacheKeyT comparable](err error) (ErrorMap[CacheKeyT], bool) {
+	// fetch usually returns the ErrorMap itself, which doesn't need errors.As
+	if em, ok := err.(ErrorMap[CacheKeyT]); ok {
+		return em, true
+	}
+	var em ErrorMap[CacheKeyT]
+	ok := errors.As(err, &em)
+	return em, ok
+}
+
+// resultDone returns the channel closed once the result of a key added to the
+// batch is resolved
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) resultDone(b *loaderBatch[KeyT, CacheKeyT, ValueT]) chan struct{} {
+	if l.streaming {
+		// keys of a streaming fetch are resolved one by one
+		return make(chan struct{})
+	}
+	return b.done
+}
 
-			b.data, b.error = l.fetch(b.keys)
-			close(b.done)
-		}(l)
+// keyIndex adds the key to the batch this shard is filling, if it was not
+// already added, and returns its result. The shard must be locked.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) keyIndex(l *KeyedLoader[KeyT, CacheKeyT, ValueT], key KeyT, cacheKey CacheKeyT) *Future[ValueT] {
+	var partition any
+	if l.partition != nil {
+		partition = l.partition(key)
 	}
+	for {
+		sb := s.pending[partition]
+		if sb != nil && atomic.LoadInt32(&sb.batch.closing) != 0 {
+			s.flush(sb)
+			sb = nil
+		}
+		var b *loaderBatch[KeyT, CacheKeyT, ValueT]
+		if sb == nil {
+			b = l.pendingBatch(partition)
+			if atomic.LoadInt32(&b.closing) != 0 {
+				continue
+			}
+		} else if pos, ok := sb.find(l, cacheKey); ok {
+			return sb.entries[pos].result
+		} else {
+			b = sb.batch
+		}
 
-	if l.maxBatch != 0 && pos >= l.maxBatch-1 {
-		if !b.closing {
-			b.closing = true
-			l.batch = nil
-			go func(l *Loader[KeyT, ValueT]) {
-				b.data, b.error = l.fetch(b.keys)
-				close(b.done)
-			}(l)
+		maxBatch := b.config.maxBatch
+		size := atomic.AddInt32(&b.size, 1)
+		if maxBatch != 0 && int(size) > maxBatch {
+			// the batch filled up before we could add to it
+			l.retire(b)
+			if sb != nil {
+				s.flush(sb)
+			}
+			continue
+		}
+
+		full := maxBatch != 0 && int(size) == maxBatch
+		if maxWeight := b.config.maxWeight; maxWeight != 0 {
+			keyWeight := int64(l.keyWeight(key))
+			weight := atomic.AddInt64(&b.weight, keyWeight)
+			if weight > int64(maxWeight) && weight != keyWeight {
+				// the key would push the batch over its weight, so the batch is
+				// sent as it is. a key heavier than the limit gets a batch of its own
+				l.retire(b)
+				go l.dispatch(b)
+				if sb != nil {
+					s.flush(sb)
+				}
+				continue
+			}
+			full = full || weight >= int64(maxWeight)
+		}
+
+		if sb == nil {
+			sb = s.newShardBatch(b)
+			if s.pending == nil {
+				s.pending = map[any]*shardBatch[KeyT, CacheKeyT, ValueT]{}
+			}
+			s.pending[partition] = sb
+		}
+		r := s.slot(l.resultDone(b))
+
+		if sb.index != nil {
+			sb.index[cacheKey] = len(sb.keys)
+		}
+		sb.keys = append(sb.keys, key)
+		sb.entries = append(sb.entries, batchEntry[CacheKeyT, ValueT]{cacheKey: cacheKey, result: r})
+
+		if full {
+			l.retire(b)
+			go l.dispatch(b)
+		}
+		return r
+	}
+}
+
+// cached returns the cached result for the cache key without locking. Keys
+// added since the read map was published are only found by load.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) cached(cacheKey CacheKeyT) (*Future[ValueT], bool) {
+	if e, ok := s.readMap()[cacheKey]; ok {
+		if r := e.load(); r != nil {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// load returns the cached result for the cache key. The shard must be locked.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) load(cacheKey CacheKeyT) (*Future[ValueT], bool) {
+	if r, ok := s.cached(cacheKey); ok || s.dirty == nil {
+		return r, ok
+	}
+	e, ok := s.dirty[cacheKey]
+	s.misses++
+	if s.misses >= len(s.dirty) {
+		s.read.Store(s.dirty)
+		s.dirty, s.misses = nil, 0
+	}
+	if !ok {
+		return nil, false
+	}
+	return e.load(), true
+}
+
+// store caches the result for the cache key. The shard must be locked.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) store(cacheKey CacheKeyT, r *Future[ValueT]) {
+	if s.dirty == nil {
+		// without a dirty map, read holds every key
+		read := s.readMap()
+		if e, ok := read[cacheKey]; ok {
+			e.store(r)
+			return
+		}
+		s.dirty = make(map[CacheKeyT]*cacheEntry[ValueT], len(read)+1)
+		for k, e := range read {
+			if e.load() != nil {
+				s.dirty[k] = e
+			}
+		}
+	} else if e, ok := s.dirty[cacheKey]; ok {
+		e.store(r)
+		return
+	}
+	if len(s.entries) == cap(s.entries) {
+		s.entries = make([]cacheEntry[ValueT], 0, 32)
+	}
+	s.entries = s.entries[:len(s.entries)+1]
+	e := &s.entries[len(s.entries)-1]
+	e.store(r)
+	s.dirty[cacheKey] = e
+}
+
+// delete evicts the cache key. The shard must be locked.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) delete(cacheKey CacheKeyT) {
+	if s.dirty == nil {
+		if e, ok := s.readMap()[cacheKey]; ok {
+			e.store(nil)
+		}
+		return
+	}
+	// entries of read that aren't in dirty were already evicted
+	if e, ok := s.dirty[cacheKey]; ok {
+		e.store(nil)
+		delete(s.dirty, cacheKey)
+	}
+}
+
+// clear evicts every key. The shard must be locked.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) clear() {
+	s.read.Store(map[CacheKeyT]*cacheEntry[ValueT](nil))
+	s.dirty, s.misses = nil, 0
+}
+
+// each calls fn with every cached result. The shard must be locked.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) each(fn func(cacheKey CacheKeyT, r *Future[ValueT])) {
+	entries := s.dirty
+	if entries == nil {
+		entries = s.readMap()
+	}
+	for cacheKey, e := range entries {
+		if r := e.load(); r != nil {
+			fn(cacheKey, r)
 		}
 	}
+}
+
+// readMap returns the published read map of the shard
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) readMap() map[CacheKeyT]*cacheEntry[ValueT] {
+	m, _ := s.read.Load().(map[CacheKeyT]*cacheEntry[ValueT])
+	return m
+}
 
-	return
+// load returns the result of the entry, or nil if it was evicted
+func (e *cacheEntry[ValueT]) load() *Future[ValueT] {
+	return (*Future[ValueT])(atomic.LoadPointer(&e.result))
+}
+
+// store sets the result of the entry, nil evicting it
+func (e *cacheEntry[ValueT]) store(r *Future[ValueT]) {
+	atomic.StorePointer(&e.result, unsafe.Pointer(r))
+}
+
+// pendingResult returns the result of the cache key if it is cached or part of
+// the batch this shard is filling for the partition. The shard must be locked.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) pendingResult(l *KeyedLoader[KeyT, CacheKeyT, ValueT], partition any, cacheKey CacheKeyT) (*Future[ValueT], bool) {
+	if !l.noCache {
+		if r, ok := s.load(cacheKey); ok && !l.expired(r) {
+			return r, true
+		}
+		return nil, false
+	}
+	if sb := s.pending[partition]; sb != nil {
+		if pos, ok := sb.find(l, cacheKey); ok {
+			return sb.entries[pos].result, true
+		}
+	}
+	return nil, false
+}
+
+// slot returns a new result that is resolved once done is closed. Results are
+// allocated in chunks rather than one per key. The shard must be locked.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) slot(done chan struct{}) *Future[ValueT] {
+	if len(s.slots) == cap(s.slots) {
+		s.slots = make([]Future[ValueT], 0, 32)
+	}
+	s.slots = s.slots[:len(s.slots)+1]
+	r := &s.slots[len(s.slots)-1]
+	r.done = done
+	return r
+}
+
+// flush moves the keys this shard added to a batch into the batch. The shard
+// must be locked.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) flush(sb *shardBatch[KeyT, CacheKeyT, ValueT]) {
+	b := sb.batch
+	b.mu.Lock()
+	if len(b.keys) == 0 {
+		// the first shard to flush hands over its keys rather than copying them
+		b.keys, b.entries = sb.keys, sb.entries
+	} else {
+		b.keys = append(b.keys, sb.keys...)
+		b.entries = append(b.entries, sb.entries...)
+	}
+	b.mu.Unlock()
+	delete(s.pending, b.partition)
+	*sb = shardBatch[KeyT, CacheKeyT, ValueT]{}
+	s.spare = sb
+}
+
+// clearedPending records that keys of pending batches may have been cleared
+// from the cache, so they have to be looked up when they are added again. The
+// shard must be locked.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) clearedPending() {
+	for _, sb := range s.pending {
+		sb.cleared = true
+	}
+}
+
+// newShardBatch returns an empty shardBatch for keys this shard adds to the
+// batch. The shard must be locked.
+func (s *loaderShard[KeyT, CacheKeyT, ValueT]) newShardBatch(b *loaderBatch[KeyT, CacheKeyT, ValueT]) *shardBatch[KeyT, CacheKeyT, ValueT] {
+	sb := s.spare
+	s.spare = nil
+	if sb == nil {
+		sb = &shardBatch[KeyT, CacheKeyT, ValueT]{}
+	}
+	sb.batch = b
+	return sb
+}
+
+// find returns the position of the cache key in the shard batch, if it was
+// added to it
+func (sb *shardBatch[KeyT, CacheKeyT, ValueT]) find(l *KeyedLoader[KeyT, CacheKeyT, ValueT], cacheKey CacheKeyT) (int, bool) {
+	if !l.noCache && !sb.cleared {
+		return 0, false
+	}
+	if sb.index == nil {
+		sb.index = make(map[CacheKeyT]int, len(sb.entries))
+		for i, e := range sb.entries {
+			sb.index[e.cacheKey] = i
+		}
+	}
+	pos, ok := sb.index[cacheKey]
+	return pos, ok
 }
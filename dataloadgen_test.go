@@ -1,9 +1,13 @@
 package dataloadgen_test
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -75,3 +79,365 @@ func TestEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestKeyedLoader(t *testing.T) {
+	t.Run("normalized keys share a cache entry", func(t *testing.T) {
+		var fetches [][]string
+		var mu sync.Mutex
+		dl := dataloadgen.NewKeyedLoader(func(keys []string) (map[string]string, error) {
+			mu.Lock()
+			fetches = append(fetches, keys)
+			mu.Unlock()
+			results := make(map[string]string, len(keys))
+			for _, key := range keys {
+				results[strings.ToLower(key)] = "user " + strings.ToLower(key)
+			}
+			return results, nil
+		}, strings.ToLower, dataloadgen.WithWait(time.Millisecond))
+
+		values, errs := dl.LoadAll([]string{"Bob@example.com", "bob@EXAMPLE.com", "alice@example.com"})
+		require.Nil(t, errs)
+		require.Equal(t, []string{"user bob@example.com", "user bob@example.com", "user alice@example.com"}, values)
+		require.Equal(t, [][]string{{"Bob@example.com", "alice@example.com"}}, fetches)
+
+		value, err := dl.Load("BOB@example.com")
+		require.NoError(t, err)
+		require.Equal(t, "user bob@example.com", value)
+		require.Len(t, fetches, 1)
+	})
+
+	t.Run("slice keys", func(t *testing.T) {
+		dl := dataloadgen.NewKeyedLoader(func(keys [][]int) (map[string]int, error) {
+			results := make(map[string]int, len(keys))
+			errs := make(dataloadgen.ErrorMap[string])
+			for _, key := range keys {
+				if len(key) == 0 {
+					errs[fmt.Sprint(key)] = fmt.Errorf("empty key")
+					continue
+				}
+				sum := 0
+				for _, n := range key {
+					sum += n
+				}
+				results[fmt.Sprint(key)] = sum
+			}
+			return results, errs
+		}, func(key []int) string { return fmt.Sprint(key) }, dataloadgen.WithWait(time.Millisecond))
+
+		values, errs := dl.LoadAll([][]int{{1, 2}, {3, 4}, {}})
+		require.Equal(t, []int{3, 7, 0}, values)
+		require.NoError(t, errs[0])
+		require.NoError(t, errs[1])
+		require.EqualError(t, errs[2], "empty key")
+	})
+}
+
+func TestShardedLoader(t *testing.T) {
+	var fetches [][]int
+	var mu sync.Mutex
+	dl := dataloadgen.NewLoader(func(keys []int) (map[int]string, error) {
+		mu.Lock()
+		fetches = append(fetches, keys)
+		mu.Unlock()
+		results := make(map[int]string, len(keys))
+		for _, key := range keys {
+			results[key] = fmt.Sprint(key)
+		}
+		return results, nil
+	},
+		dataloadgen.WithShards(8),
+		dataloadgen.WithBatchCapacity(10),
+		dataloadgen.WithWait(time.Millisecond),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				// every goroutine loads the same keys in a different order
+				key := (i*7 + j) % 100
+				value, err := dl.Load(key)
+				require.NoError(t, err)
+				require.Equal(t, fmt.Sprint(key), value)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[int]bool{}
+	for _, keys := range fetches {
+		require.LessOrEqual(t, len(keys), 10)
+		for _, key := range keys {
+			require.False(t, seen[key], "key %d fetched twice", key)
+			seen[key] = true
+		}
+	}
+	require.Len(t, seen, 100)
+	require.Less(t, len(fetches), 100, "keys should be coalesced across shards")
+}
+
+func TestShardedLoaderHashesKeysByValue(t *testing.T) {
+	type scoreKey struct {
+		Score  float64
+		Active bool
+	}
+	var fetches int32
+	dl := dataloadgen.NewLoader(func(keys []scoreKey) (map[scoreKey]string, error) {
+		atomic.AddInt32(&fetches, 1)
+		results := make(map[scoreKey]string, len(keys))
+		for _, key := range keys {
+			results[key] = fmt.Sprint(key.Score, key.Active)
+		}
+		return results, nil
+	},
+		dataloadgen.WithShards(64),
+		dataloadgen.WithWait(time.Millisecond),
+	)
+
+	value, err := dl.Load(scoreKey{Score: 0, Active: true})
+	require.NoError(t, err)
+	require.Equal(t, "0 true", value)
+
+	// -0 == 0, so it must be found in the shard 0 was cached in
+	value, err = dl.Load(scoreKey{Score: math.Copysign(0, -1), Active: true})
+	require.NoError(t, err)
+	require.Equal(t, "0 true", value)
+	require.EqualValues(t, 1, atomic.LoadInt32(&fetches))
+
+	for i := 1; i < 100; i++ {
+		dl.Prime(scoreKey{Score: float64(i) / 2, Active: i%2 == 0}, "primed")
+	}
+	for i := 1; i < 100; i++ {
+		value, err := dl.Load(scoreKey{Score: float64(i) / 2, Active: i%2 == 0})
+		require.NoError(t, err)
+		require.Equal(t, "primed", value)
+	}
+	require.EqualValues(t, 1, atomic.LoadInt32(&fetches))
+}
+
+func TestCacheHitsWithoutLocking(t *testing.T) {
+	dl, fetches := RecordingLoader(func(ctx context.Context, call int, keys []int) (map[int]string, error) {
+		results := make(map[int]string, len(keys))
+		for _, key := range keys {
+			results[key] = fmt.Sprint(key, " v", call)
+		}
+		return results, nil
+	}, dataloadgen.WithWait(time.Millisecond))
+
+	keys := make([]int, 100)
+	for i := range keys {
+		keys[i] = i
+	}
+	dl.LoadAll(keys)
+	// hits move the keys to the map that is read without locking
+	for i := 0; i < 3; i++ {
+		values, errs := dl.LoadAll(keys)
+		require.Nil(t, errs)
+		require.Equal(t, "7 v1", values[7])
+	}
+
+	dl.Clear(7)
+	dl.Set(8, "set")
+	values, errs := dl.LoadAll([]int{7, 8, 9})
+	require.Nil(t, errs)
+	require.Equal(t, []string{"7 v2", "set", "9 v1"}, values)
+
+	dl.ClearAll()
+	value, err := dl.Load(9)
+	require.NoError(t, err)
+	require.Equal(t, "9 v3", value)
+	require.Len(t, fetches(), 3)
+}
+
+func TestNotFound(t *testing.T) {
+	fetch := func(keys []int) (map[int]string, error) {
+		results := make(map[int]string, len(keys))
+		for _, key := range keys {
+			if key%2 == 1 {
+				results[key] = fmt.Sprint(key)
+			}
+		}
+		return results, nil
+	}
+
+	t.Run("error reports the key", func(t *testing.T) {
+		dl := dataloadgen.NewLoader(fetch, dataloadgen.WithWait(time.Millisecond))
+		_, err := dl.Load(2)
+		require.ErrorIs(t, err, dataloadgen.ErrNotFound)
+		var notFound *dataloadgen.NotFoundError[int]
+		require.ErrorAs(t, err, &notFound)
+		require.Equal(t, 2, notFound.Key)
+		require.EqualError(t, err, "Record not found via dataloader: 2")
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		dl := dataloadgen.NewLoader(fetch,
+			dataloadgen.WithWait(time.Millisecond),
+			dataloadgen.WithNotFoundZero(),
+		)
+		values, errs := dl.LoadAll([]int{1, 2})
+		require.Nil(t, errs)
+		require.Equal(t, []string{"1", ""}, values)
+	})
+
+	t.Run("default function", func(t *testing.T) {
+		dl := dataloadgen.NewLoader(fetch, dataloadgen.WithWait(time.Millisecond))
+		dl.SetNotFoundFunc(func(key int) (string, error) {
+			return fmt.Sprint("default ", key), nil
+		})
+		values, errs := dl.LoadAll([]int{1, 2})
+		require.Nil(t, errs)
+		require.Equal(t, []string{"1", "default 2"}, values)
+	})
+}
+
+func TestPriming(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	dl := dataloadgen.NewLoader(func(keys []int) (map[int]string, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		results := make(map[int]string, len(keys))
+		for _, key := range keys {
+			results[key] = fmt.Sprint("fetched ", key)
+		}
+		return results, nil
+	},
+		dataloadgen.WithWait(time.Millisecond),
+		dataloadgen.WithShards(4),
+	)
+
+	t.Run("Prime does not overwrite", func(t *testing.T) {
+		require.True(t, dl.Prime(1, "primed 1"))
+		require.False(t, dl.Prime(1, "primed again"))
+		value, err := dl.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "primed 1", value)
+	})
+
+	t.Run("Set overwrites", func(t *testing.T) {
+		dl.Set(1, "set 1")
+		value, err := dl.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "set 1", value)
+	})
+
+	t.Run("Set replaces an in-flight load for later callers", func(t *testing.T) {
+		thunk := dl.LoadThunk(2)
+		dl.Set(2, "set 2")
+		value, err := dl.Load(2)
+		require.NoError(t, err)
+		require.Equal(t, "set 2", value)
+
+		close(release)
+		value, err = thunk()
+		require.NoError(t, err)
+		require.Equal(t, "fetched 2", value)
+		value, err = dl.Load(2)
+		require.NoError(t, err)
+		require.Equal(t, "set 2", value)
+	})
+
+	t.Run("PrimeMany", func(t *testing.T) {
+		primed := dl.PrimeMany(map[int]string{1: "many 1", 3: "many 3", 4: "many 4"})
+		require.Equal(t, 2, primed)
+		values, errs := dl.LoadAll([]int{1, 3, 4})
+		require.Nil(t, errs)
+		require.Equal(t, []string{"set 1", "many 3", "many 4"}, values)
+	})
+
+	t.Run("PrimeError", func(t *testing.T) {
+		forbidden := fmt.Errorf("forbidden")
+		require.True(t, dl.PrimeError(5, forbidden))
+		require.False(t, dl.PrimeError(5, forbidden))
+		_, err := dl.Load(5)
+		require.ErrorIs(t, err, forbidden)
+	})
+
+	require.EqualValues(t, 1, atomic.LoadInt32(&fetches))
+}
+
+func TestLoadAll(t *testing.T) {
+	fetch := func(ctx context.Context, call int, keys []int) (map[int]string, error) {
+		results := make(map[int]string, len(keys))
+		for _, key := range keys {
+			results[key] = fmt.Sprint(key)
+		}
+		return results, nil
+	}
+
+	t.Run("does not wait for the timer", func(t *testing.T) {
+		dl, fetches := RecordingLoader(fetch, dataloadgen.WithWait(time.Hour), dataloadgen.WithBatchCapacity(2))
+		values, errs := dl.LoadAll([]int{1, 2, 3, 1, 4, 5})
+		require.Nil(t, errs)
+		require.Equal(t, []string{"1", "2", "3", "1", "4", "5"}, values)
+		require.ElementsMatch(t, [][]int{{1, 2}, {3, 4}, {5}}, fetches())
+	})
+
+	t.Run("merges with keys in flight", func(t *testing.T) {
+		dl, fetches := RecordingLoader(fetch, dataloadgen.WithWait(50*time.Millisecond))
+		thunk := dl.LoadThunk(1)
+		values, errs := dl.LoadAll([]int{1, 2, 3})
+		require.Nil(t, errs)
+		require.Equal(t, []string{"1", "2", "3"}, values)
+		_, err := thunk()
+		require.NoError(t, err)
+		require.Equal(t, [][]int{{2, 3}, {1}}, fetches())
+	})
+
+	t.Run("thunks are batched together", func(t *testing.T) {
+		dl, fetches := RecordingLoader(fetch, dataloadgen.WithWait(10*time.Millisecond))
+		first := dl.LoadAllThunk([]int{1, 2})
+		second := dl.LoadAllThunk([]int{2, 3})
+		values, errs := first()
+		require.Equal(t, []string{"1", "2"}, values)
+		require.Equal(t, []error{nil, nil}, errs)
+		values, errs = second()
+		require.Equal(t, []string{"2", "3"}, values)
+		require.Equal(t, []error{nil, nil}, errs)
+		require.Equal(t, [][]int{{1, 2, 3}}, fetches())
+	})
+
+	t.Run("without a cache", func(t *testing.T) {
+		dl, fetches := RecordingLoader(fetch, dataloadgen.WithWait(50*time.Millisecond), dataloadgen.WithoutCache())
+		thunk := dl.LoadThunk(1)
+		values, errs := dl.LoadAll([]int{1, 2, 2})
+		require.Nil(t, errs)
+		require.Equal(t, []string{"1", "2", "2"}, values)
+		_, err := thunk()
+		require.NoError(t, err)
+		require.Equal(t, [][]int{{2}, {1}}, fetches())
+	})
+}
+
+func TestPartialResults(t *testing.T) {
+	fetch := func(keys []int) (map[int]string, error) {
+		results := make(map[int]string, len(keys))
+		for _, key := range keys {
+			if key%2 == 1 {
+				results[key] = fmt.Sprint(key)
+			}
+		}
+		return results, fmt.Errorf("shard of even keys is down")
+	}
+
+	t.Run("fails every key by default", func(t *testing.T) {
+		dl := dataloadgen.NewLoader(fetch, dataloadgen.WithWait(time.Millisecond))
+		_, errs := dl.LoadAll([]int{1, 2})
+		require.EqualError(t, errs[0], "shard of even keys is down")
+		require.EqualError(t, errs[1], "shard of even keys is down")
+	})
+
+	t.Run("only fails keys without a value", func(t *testing.T) {
+		dl := dataloadgen.NewLoader(fetch,
+			dataloadgen.WithWait(time.Millisecond),
+			dataloadgen.WithPartialResults(),
+		)
+		values, errs := dl.LoadAll([]int{1, 2})
+		require.Equal(t, "1", values[0])
+		require.NoError(t, errs[0])
+		require.EqualError(t, errs[1], "shard of even keys is down")
+	})
+}
@@ -1,9 +1,26 @@
 package dataloadgen
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrNotFound = errors.New("Record not found via dataloader")
 
+// NotFoundError is the error for a key that fetch returned no value for. It
+// matches ErrNotFound with errors.Is, and reports the key that was missing.
+type NotFoundError[KeyT any] struct {
+	Key KeyT
+}
+
+func (e *NotFoundError[KeyT]) Error() string {
+	return fmt.Sprintf("%s: %v", ErrNotFound, e.Key)
+}
+
+func (e *NotFoundError[KeyT]) Unwrap() error {
+	return ErrNotFound
+}
+
 type ErrorMap[KeyT comparable] map[KeyT]error
 
 func (e ErrorMap[KeyT]) Error() string {
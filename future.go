@@ -0,0 +1,111 @@
+package dataloadgen
+
+import "context"
+
+// Future is the pending result of a load. It is resolved once the batch
+// containing its key has been fetched, and can be composed with futures from
+// other loaders using Then, Map and All without spawning goroutines manually.
+type Future[ValueT any] struct {
+	value ValueT
+	err   error
+	done  chan struct{}
+
+	// when a negative result stops being served from the cache, in unix
+	// nanoseconds, 0 = never (see WithNegativeCache)
+	expires int64
+}
+
+// closed is the done channel of futures that are resolved up front
+var closed = func() chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}()
+
+// Get blocks until the future is resolved and returns its value
+func (f *Future[ValueT]) Get() (ValueT, error) {
+	<-f.done
+	return f.value, f.err
+}
+
+// GetContext blocks until the future is resolved or the context is done,
+// whichever happens first. The load itself is not cancelled with the context.
+func (f *Future[ValueT]) GetContext(ctx context.Context) (ValueT, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero ValueT
+		return zero, ctx.Err()
+	}
+}
+
+// Done returns a channel that is closed once the future is resolved
+func (f *Future[ValueT]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Ready reports whether the future is resolved, without blocking
+func (f *Future[ValueT]) Ready() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Then returns a future that resolves to the future returned by fn once f has
+// resolved, such as loading the author of a post from another loader. If f
+// fails, fn is not called and the returned future fails with the same error.
+func Then[ValueT, NextT any](f *Future[ValueT], fn func(ValueT) *Future[NextT]) *Future[NextT] {
+	return async(func() (NextT, error) {
+		value, err := f.Get()
+		if err != nil {
+			var zero NextT
+			return zero, err
+		}
+		return fn(value).Get()
+	})
+}
+
+// Map returns a future that resolves to fn applied to the value of f. If f
+// fails, fn is not called and the returned future fails with the same error.
+func Map[ValueT, NextT any](f *Future[ValueT], fn func(ValueT) (NextT, error)) *Future[NextT] {
+	return async(func() (NextT, error) {
+		value, err := f.Get()
+		if err != nil {
+			var zero NextT
+			return zero, err
+		}
+		return fn(value)
+	})
+}
+
+// All returns a future that resolves to the values of all the futures, in
+// order. It fails with the first error of the futures, in order.
+func All[ValueT any](futures ...*Future[ValueT]) *Future[[]ValueT] {
+	return async(func() ([]ValueT, error) {
+		values := make([]ValueT, len(futures))
+		var firstErr error
+		for i, f := range futures {
+			var err error
+			values[i], err = f.Get()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return values, firstErr
+	})
+}
+
+// async returns a future resolved by calling fn in a new goroutine
+func async[ValueT any](fn func() (ValueT, error)) *Future[ValueT] {
+	done := make(chan struct{})
+	f := &Future[ValueT]{done: done}
+	go func() {
+		f.value, f.err = fn()
+		close(done)
+	}()
+	return f
+}
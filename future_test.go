@@ -0,0 +1,90 @@
+package dataloadgen_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+type post struct {
+	ID       int
+	AuthorID string
+}
+
+func TestFuture(t *testing.T) {
+	posts := dataloadgen.NewLoader(func(keys []int) (map[int]post, error) {
+		results := make(map[int]post, len(keys))
+		for _, key := range keys {
+			if key > 0 {
+				results[key] = post{ID: key, AuthorID: fmt.Sprint("author ", key%2)}
+			}
+		}
+		return results, nil
+	}, dataloadgen.WithWait(time.Millisecond))
+
+	var authorFetches [][]string
+	authors := dataloadgen.NewLoader(func(keys []string) (map[string]string, error) {
+		authorFetches = append(authorFetches, keys)
+		results := make(map[string]string, len(keys))
+		for _, key := range keys {
+			results[key] = "name of " + key
+		}
+		return results, nil
+	}, dataloadgen.WithWait(time.Millisecond))
+
+	authorOf := func(id int) *dataloadgen.Future[string] {
+		return dataloadgen.Then(posts.LoadFuture(id), func(p post) *dataloadgen.Future[string] {
+			return authors.LoadFuture(p.AuthorID)
+		})
+	}
+
+	t.Run("Then", func(t *testing.T) {
+		names, err := dataloadgen.All(authorOf(1), authorOf(2), authorOf(3)).Get()
+		require.NoError(t, err)
+		require.Equal(t, []string{"name of author 1", "name of author 0", "name of author 1"}, names)
+		require.Len(t, authorFetches, 1)
+	})
+
+	t.Run("Then propagates errors", func(t *testing.T) {
+		_, err := authorOf(-1).Get()
+		require.ErrorIs(t, err, dataloadgen.ErrNotFound)
+	})
+
+	t.Run("Map", func(t *testing.T) {
+		author, err := dataloadgen.Map(posts.LoadFuture(4), func(p post) (string, error) {
+			return p.AuthorID, nil
+		}).Get()
+		require.NoError(t, err)
+		require.Equal(t, "author 0", author)
+
+		_, err = dataloadgen.Map(posts.LoadFuture(5), func(p post) (string, error) {
+			return "", errors.New("forbidden")
+		}).Get()
+		require.EqualError(t, err, "forbidden")
+	})
+
+	t.Run("Done and Ready", func(t *testing.T) {
+		f := posts.LoadFuture(6)
+		require.False(t, f.Ready())
+		<-f.Done()
+		require.True(t, f.Ready())
+		p, err := f.Get()
+		require.NoError(t, err)
+		require.Equal(t, 6, p.ID)
+	})
+
+	t.Run("GetContext", func(t *testing.T) {
+		slow := dataloadgen.NewLoader(func(keys []int) (map[int]int, error) {
+			return map[int]int{}, nil
+		}, dataloadgen.WithWait(time.Hour))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		_, err := slow.LoadFuture(1).GetContext(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,57 @@
+package dataloadgen
+
+// NewGroupLoader creates a new Loader for one-to-many relations, such as the
+// comments of posts. fetch returns a flat list of values for all the keys, and
+// groupKey returns the key each value belongs to. Every key resolves to the
+// values grouped under it, in the order fetch returned them, and keys without
+// any values resolve to an empty slice rather than ErrNotFound. When fetch fails
+// with an error other than an ErrorMap, keys without any values get the error,
+// even WithPartialResults.
+func NewGroupLoader[KeyT comparable, ValueT any](fetch func(keys []KeyT) ([]ValueT, error), groupKey func(ValueT) KeyT, options ...Option) *Loader[KeyT, []ValueT] {
+	return newGroupLoader(func(keys []KeyT, limit int) ([]ValueT, error) {
+		return fetch(keys)
+	}, groupKey, 0, options...)
+}
+
+// NewLimitedGroupLoader creates a new Loader for one-to-many relations like
+// NewGroupLoader that returns at most limit values per key, such as the first
+// page of comments of each post. fetch is passed the limit so the backend can
+// apply it, for instance with a window function, rather than returning every
+// value. Values fetch returns beyond the limit are dropped in the order it
+// returned them.
+func NewLimitedGroupLoader[KeyT comparable, ValueT any](fetch func(keys []KeyT, limit int) ([]ValueT, error), groupKey func(ValueT) KeyT, limit int, options ...Option) *Loader[KeyT, []ValueT] {
+	return newGroupLoader(fetch, groupKey, limit, options...)
+}
+
+// newGroupLoader creates a group loader returning at most limit values per key,
+// 0 meaning no limit
+func newGroupLoader[KeyT comparable, ValueT any](fetch func(keys []KeyT, limit int) ([]ValueT, error), groupKey func(ValueT) KeyT, limit int, options ...Option) *Loader[KeyT, []ValueT] {
+	return NewLoader(func(keys []KeyT) (map[KeyT][]ValueT, error) {
+		values, err := fetch(keys, limit)
+		groups := make(map[KeyT][]ValueT, len(keys))
+		for _, key := range keys {
+			groups[key] = []ValueT{}
+		}
+		for _, value := range values {
+			key := groupKey(value)
+			group, ok := groups[key]
+			// values for keys that were not requested are ignored
+			if !ok || (limit > 0 && len(group) >= limit) {
+				continue
+			}
+			groups[key] = append(group, value)
+		}
+		if err != nil {
+			if _, ok := asErrorMap[KeyT](err); !ok {
+				// keys without values may only be missing because fetch failed,
+				// so they get the error even WithPartialResults
+				for key, group := range groups {
+					if len(group) == 0 {
+						delete(groups, key)
+					}
+				}
+			}
+		}
+		return groups, err
+	}, options...)
+}
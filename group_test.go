@@ -0,0 +1,78 @@
+package dataloadgen_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+type comment struct {
+	PostID int
+	Text   string
+}
+
+func TestGroupLoader(t *testing.T) {
+	comments := []comment{
+		{PostID: 1, Text: "first"},
+		{PostID: 2, Text: "second"},
+		{PostID: 1, Text: "third"},
+		{PostID: 1, Text: "fourth"},
+		{PostID: 4, Text: "not requested"},
+	}
+	fetch := func(keys []int) ([]comment, error) {
+		return comments, nil
+	}
+	postID := func(c comment) int { return c.PostID }
+
+	t.Run("groups values by key", func(t *testing.T) {
+		dl := dataloadgen.NewGroupLoader(fetch, postID, dataloadgen.WithWait(time.Millisecond))
+		groups, errs := dl.LoadAll([]int{1, 2, 3})
+		require.Nil(t, errs)
+		require.Equal(t, [][]comment{
+			{comments[0], comments[2], comments[3]},
+			{comments[1]},
+			{},
+		}, groups)
+	})
+
+	t.Run("limits values per key", func(t *testing.T) {
+		var limits []int
+		dl := dataloadgen.NewLimitedGroupLoader(func(keys []int, limit int) ([]comment, error) {
+			limits = append(limits, limit)
+			return comments, nil
+		}, postID, 2, dataloadgen.WithWait(time.Millisecond))
+		groups, errs := dl.LoadAll([]int{1, 2})
+		require.Nil(t, errs)
+		require.Equal(t, []int{2}, limits)
+		require.Equal(t, [][]comment{
+			{comments[0], comments[2]},
+			{comments[1]},
+		}, groups)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		dl := dataloadgen.NewGroupLoader(func(keys []int) ([]comment, error) {
+			return nil, dataloadgen.ErrorMap[int]{2: errors.New("forbidden")}
+		}, postID, dataloadgen.WithWait(time.Millisecond))
+		groups, errs := dl.LoadAll([]int{1, 2})
+		require.Equal(t, []comment{}, groups[0])
+		require.NoError(t, errs[0])
+		require.EqualError(t, errs[1], "forbidden")
+	})
+
+	t.Run("partial results", func(t *testing.T) {
+		dl := dataloadgen.NewGroupLoader(func(keys []int) ([]comment, error) {
+			return comments[:2], errors.New("db down")
+		}, postID, dataloadgen.WithWait(time.Millisecond), dataloadgen.WithPartialResults())
+		groups, errs := dl.LoadAll([]int{1, 2, 3})
+		require.Equal(t, []comment{comments[0]}, groups[0])
+		require.NoError(t, errs[0])
+		require.Equal(t, []comment{comments[1]}, groups[1])
+		require.NoError(t, errs[1])
+		require.Nil(t, groups[2])
+		require.EqualError(t, errs[2], "db down")
+	})
+}
@@ -0,0 +1,116 @@
+package dataloadgen
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"math"
+	"reflect"
+)
+
+// hashKey hashes a cache key so it can be assigned to a shard. Integers and
+// pointers are hashed directly, anything else is hashed by value, so equal
+// comparable values always land in the same shard.
+func hashKey(seed maphash.Seed, key any) uint64 {
+	switch k := key.(type) {
+	case int:
+		return mix(uint64(k))
+	case int8:
+		return mix(uint64(k))
+	case int16:
+		return mix(uint64(k))
+	case int32:
+		return mix(uint64(k))
+	case int64:
+		return mix(uint64(k))
+	case uint:
+		return mix(uint64(k))
+	case uint8:
+		return mix(uint64(k))
+	case uint16:
+		return mix(uint64(k))
+	case uint32:
+		return mix(uint64(k))
+	case uint64:
+		return mix(k)
+	case uintptr:
+		return mix(uint64(k))
+	}
+
+	var h maphash.Hash
+	h.SetSeed(seed)
+	if k, ok := key.(string); ok {
+		h.WriteString(k)
+		return h.Sum64()
+	}
+	switch v := reflect.ValueOf(key); v.Kind() {
+	case reflect.Pointer, reflect.UnsafePointer, reflect.Chan:
+		return mix(uint64(v.Pointer()))
+	}
+	writeValue(&h, reflect.ValueOf(key))
+	return h.Sum64()
+}
+
+// writeValue writes a comparable value to the hash. Values that are == write
+// the same bytes: -0 is written as 0, and pointers are written as addresses, so
+// this is stable even if the values they point to change.
+func writeValue(h *maphash.Hash, v reflect.Value) {
+	var buf [8]byte
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			h.WriteByte(1)
+		} else {
+			h.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v.Int()))
+		h.Write(buf[:])
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		binary.LittleEndian.PutUint64(buf[:], v.Uint())
+		h.Write(buf[:])
+	case reflect.Float32, reflect.Float64:
+		writeFloat(h, v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		writeFloat(h, real(c))
+		writeFloat(h, imag(c))
+	case reflect.String:
+		h.WriteString(v.String())
+	case reflect.Pointer, reflect.UnsafePointer, reflect.Chan:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v.Pointer()))
+		h.Write(buf[:])
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			writeValue(h, v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			writeValue(h, v.Field(i))
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			h.WriteByte(0)
+		} else {
+			h.WriteByte(1)
+			writeValue(h, v.Elem())
+		}
+	}
+}
+
+// writeFloat writes a float to the hash, with -0 written as 0 since they are ==
+func writeFloat(h *maphash.Hash, f float64) {
+	if f == 0 {
+		f = 0
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+	h.Write(buf[:])
+}
+
+// mix spreads sequential integers evenly across shards
+func mix(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	return k
+}
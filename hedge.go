@@ -0,0 +1,162 @@
+package dataloadgen
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithHedgedFetch issues a second, identical fetch for a batch whose fetch
+// hasn't completed after delay, and resolves the batch with whichever fetch
+// completes first. The context of the other fetch is cancelled. This trades
+// extra load on the backend for a shorter latency tail, see HedgeStats.
+// Default is 0 (no hedging)
+func WithHedgedFetch(delay time.Duration) Option {
+	return func(l *loaderConfig) {
+		l.hedgeDelay = delay
+	}
+}
+
+// WithHedgedFetchPercentile hedges fetches like WithHedgedFetch, with a delay
+// that is the given percentile (between 0 and 100) of the durations of recent
+// fetches, so only the slowest fetches are hedged. Until enough fetches have
+// been observed, the delay set with WithHedgedFetch is used, if any.
+func WithHedgedFetchPercentile(percentile float64) Option {
+	return func(l *loaderConfig) {
+		l.hedgePercentile = percentile
+	}
+}
+
+const (
+	// the number of recent fetch durations the hedging percentile is taken from
+	hedgeWindow = 128
+	// the number of fetch durations needed before the percentile is used
+	hedgeMinSamples = 16
+)
+
+// HedgeStats counts the hedged fetches of a loader
+type HedgeStats struct {
+	// Hedged is the number of batches a second fetch was issued for
+	Hedged int64
+	// Won is the number of hedged batches the second fetch completed first for
+	Won int64
+}
+
+// HedgeStats returns the number of hedged fetches since the loader was created
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) HedgeStats() HedgeStats {
+	return HedgeStats{
+		Hedged: atomic.LoadInt64(&l.hedges.hedged),
+		Won:    atomic.LoadInt64(&l.hedges.won),
+	}
+}
+
+// hedgeState keeps the counters and recent fetch durations of a hedging loader
+type hedgeState struct {
+	hedged int64
+	won    int64
+
+	// ring buffer of the most recent fetch durations
+	durations [hedgeWindow]time.Duration
+	observed  int
+
+	// mutex to prevent races on durations
+	mu sync.Mutex
+}
+
+type hedgeResult[CacheKeyT comparable, ValueT any] struct {
+	data  map[CacheKeyT]ValueT
+	err   error
+	hedge bool
+}
+
+// fetchBatch fetches the keys of the batch, hedging the fetch if it is slow
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) fetchBatch(ctx context.Context, b *loaderBatch[KeyT, CacheKeyT, ValueT]) (map[CacheKeyT]ValueT, error) {
+	if l.hedgeDelay <= 0 && l.hedgePercentile <= 0 {
+		return l.fetch(ctx, b.keys)
+	}
+	start := time.Now()
+	delay := l.hedgeAfter()
+	if delay <= 0 {
+		data, err := l.fetch(ctx, b.keys)
+		l.observe(time.Since(start))
+		return data, err
+	}
+
+	// both fetches send to results, so the one that loses doesn't block
+	results := make(chan hedgeResult[CacheKeyT, ValueT], 2)
+	fetch := func(ctx context.Context, keys []KeyT, hedge bool) {
+		data, err := l.fetch(ctx, keys)
+		results <- hedgeResult[CacheKeyT, ValueT]{data: data, err: err, hedge: hedge}
+	}
+	// the hedge gets its own copy of the keys, so fetches that sort or rewrite
+	// them in place don't race with each other
+	hedgeKeys := make([]KeyT, len(b.keys))
+	copy(hedgeKeys, b.keys)
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	defer cancelPrimary()
+	go fetch(primaryCtx, b.keys, false)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		l.observe(time.Since(start))
+		return r.data, r.err
+	case <-timer.C:
+	}
+
+	atomic.AddInt64(&l.hedges.hedged, 1)
+	hedgeCtx, cancelHedge := context.WithCancel(ctx)
+	defer cancelHedge()
+	go fetch(hedgeCtx, hedgeKeys, true)
+
+	// the context of the fetch that lost is cancelled on return
+	r := <-results
+	if r.hedge {
+		atomic.AddInt64(&l.hedges.won, 1)
+	}
+	l.observe(time.Since(start))
+	return r.data, r.err
+}
+
+// hedgeAfter returns how long to wait for a fetch before hedging it, 0 if it
+// shouldn't be hedged
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) hedgeAfter() time.Duration {
+	if l.hedgePercentile <= 0 {
+		return l.hedgeDelay
+	}
+	h := &l.hedges
+	h.mu.Lock()
+	n := h.observed
+	if n > hedgeWindow {
+		n = hedgeWindow
+	}
+	if n < hedgeMinSamples {
+		h.mu.Unlock()
+		return l.hedgeDelay
+	}
+	durations := make([]time.Duration, n)
+	copy(durations, h.durations[:n])
+	h.mu.Unlock()
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	i := int(float64(n) * l.hedgePercentile / 100)
+	if i >= n {
+		i = n - 1
+	}
+	return durations[i]
+}
+
+// observe records how long a fetch took, when hedging by percentile
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) observe(d time.Duration) {
+	if l.hedgePercentile <= 0 {
+		return
+	}
+	h := &l.hedges
+	h.mu.Lock()
+	h.durations[h.observed%hedgeWindow] = d
+	h.observed++
+	h.mu.Unlock()
+}
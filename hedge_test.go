@@ -0,0 +1,96 @@
+package dataloadgen_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedgedFetch(t *testing.T) {
+	// the first fetch of every batch hangs until its context is cancelled when
+	// slow is set, the second one returns right away
+	slowFirst := func(slow *int32, cancelled chan struct{}) func(ctx context.Context, call int, keys []int) (map[int]string, error) {
+		return func(ctx context.Context, call int, keys []int) (map[int]string, error) {
+			if atomic.LoadInt32(slow) != 0 && call%2 == 1 {
+				<-ctx.Done()
+				cancelled <- struct{}{}
+				return nil, ctx.Err()
+			}
+			results := make(map[int]string, len(keys))
+			for _, key := range keys {
+				results[key] = fmt.Sprint(key, " from call ", call)
+			}
+			return results, nil
+		}
+	}
+
+	t.Run("fixed delay", func(t *testing.T) {
+		slow := int32(1)
+		cancelled := make(chan struct{}, 1)
+		dl, _ := RecordingLoader(slowFirst(&slow, cancelled), dataloadgen.WithWait(time.Millisecond), dataloadgen.WithHedgedFetch(10*time.Millisecond))
+		value, err := dl.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "1 from call 2", value)
+		<-cancelled
+		require.Equal(t, dataloadgen.HedgeStats{Hedged: 1, Won: 1}, dl.HedgeStats())
+	})
+
+	t.Run("fetches get their own keys", func(t *testing.T) {
+		cancelled := make(chan struct{}, 1)
+		dl, fetches := RecordingLoader(func(ctx context.Context, call int, keys []int) (map[int]string, error) {
+			// fetches often sort their keys in place before querying
+			sort.Ints(keys)
+			results := make(map[int]string, len(keys))
+			for _, key := range keys {
+				results[key] = fmt.Sprint(key)
+			}
+			if call == 1 {
+				<-ctx.Done()
+				cancelled <- struct{}{}
+				return nil, ctx.Err()
+			}
+			return results, nil
+		},
+			dataloadgen.WithWait(time.Millisecond),
+			dataloadgen.WithHedgedFetch(10*time.Millisecond),
+		)
+		values, errs := dl.LoadAll([]int{3, 1, 2})
+		require.Nil(t, errs)
+		require.Equal(t, []string{"3", "1", "2"}, values)
+		<-cancelled
+		require.Equal(t, [][]int{{3, 1, 2}, {3, 1, 2}}, fetches())
+	})
+
+	t.Run("fast fetches are not hedged", func(t *testing.T) {
+		var slow int32
+		dl, _ := RecordingLoader(slowFirst(&slow, nil), dataloadgen.WithWait(time.Millisecond), dataloadgen.WithHedgedFetch(time.Second))
+		value, err := dl.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "1 from call 1", value)
+		require.Equal(t, dataloadgen.HedgeStats{}, dl.HedgeStats())
+	})
+
+	t.Run("observed percentile", func(t *testing.T) {
+		var slow int32
+		cancelled := make(chan struct{}, 1)
+		dl, _ := RecordingLoader(slowFirst(&slow, cancelled), dataloadgen.WithWait(time.Millisecond), dataloadgen.WithHedgedFetchPercentile(90))
+		for key := 0; key < 16; key++ {
+			_, err := dl.Load(key)
+			require.NoError(t, err)
+		}
+		require.Equal(t, dataloadgen.HedgeStats{}, dl.HedgeStats())
+
+		atomic.StoreInt32(&slow, 1)
+		value, err := dl.Load(100)
+		require.NoError(t, err)
+		require.Equal(t, "100 from call 18", value)
+		<-cancelled
+		require.Equal(t, dataloadgen.HedgeStats{Hedged: 1, Won: 1}, dl.HedgeStats())
+	})
+}
@@ -0,0 +1,151 @@
+package dataloadgen
+
+import "sync"
+
+// Invalidation names cache keys to clear from loaders
+type Invalidation[CacheKeyT any] struct {
+	// Keys are the cache keys to clear
+	Keys []CacheKeyT
+	// All clears every key
+	All bool
+}
+
+// Bus carries invalidations between loaders, usually of different instances of
+// a service, so a key cleared by one of them is cleared by all of them.
+// Implementations are transports such as a pub/sub channel, see NewMemoryBus
+// and NewChannelBus.
+type Bus[CacheKeyT any] interface {
+	// Publish sends the invalidation to every subscriber, including the loader
+	// publishing it. Clearing keys is idempotent, so that is harmless.
+	Publish(invalidation Invalidation[CacheKeyT])
+
+	// Subscribe calls fn with every invalidation published until the returned
+	// function is called
+	Subscribe(fn func(Invalidation[CacheKeyT])) (unsubscribe func())
+}
+
+// SetInvalidationBus makes Clear and ClearAll publish the keys they clear to
+// bus, and subscribes the loader to bus to clear the keys other loaders
+// publish. Call Close on the loader to unsubscribe it.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) SetInvalidationBus(bus Bus[CacheKeyT]) {
+	l.Close()
+	l.bus, l.unsubscribe = bus, nil
+	if bus != nil {
+		l.unsubscribe = bus.Subscribe(l.invalidate)
+	}
+}
+
+// Close unsubscribes the loader from its invalidation bus. The loader keeps
+// working, but no longer clears keys published by other loaders.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) Close() {
+	if l.unsubscribe != nil {
+		l.unsubscribe()
+	}
+}
+
+// invalidate clears the keys of an invalidation received from the bus
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) invalidate(invalidation Invalidation[CacheKeyT]) {
+	if invalidation.All {
+		l.evictAll()
+		return
+	}
+	for _, cacheKey := range invalidation.Keys {
+		l.evict(cacheKey)
+	}
+}
+
+// MemoryBus is a Bus delivering invalidations to the subscribers in the same
+// process, synchronously. It is meant for tests, and for loaders that share a
+// process but not a cache.
+type MemoryBus[CacheKeyT any] struct {
+	subscribers map[int]func(Invalidation[CacheKeyT])
+	next        int
+
+	mu sync.RWMutex
+}
+
+// NewMemoryBus creates a new MemoryBus without subscribers
+func NewMemoryBus[CacheKeyT any]() *MemoryBus[CacheKeyT] {
+	return &MemoryBus[CacheKeyT]{
+		subscribers: map[int]func(Invalidation[CacheKeyT]){},
+	}
+}
+
+// Publish implements Bus
+func (b *MemoryBus[CacheKeyT]) Publish(invalidation Invalidation[CacheKeyT]) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, fn := range b.subscribers {
+		fn(invalidation)
+	}
+}
+
+// Subscribe implements Bus
+func (b *MemoryBus[CacheKeyT]) Subscribe(fn func(Invalidation[CacheKeyT])) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.subscribers[id] = fn
+	return func() {
+		b.mu.Lock()
+		delete(b.subscribers, id)
+		b.mu.Unlock()
+	}
+}
+
+// ChannelBus is a Bus adapting channels, such as a change-data-capture feed of
+// the rows that changed in a database, or the receiving and sending ends of a
+// message broker.
+type ChannelBus[CacheKeyT any] struct {
+	out chan<- Invalidation[CacheKeyT]
+	*MemoryBus[CacheKeyT]
+
+	// called with the invalidations that couldn't be sent to out
+	onDropped func(Invalidation[CacheKeyT])
+}
+
+// NewChannelBus creates a new ChannelBus. Invalidations received from in are
+// delivered to the subscribers until in is closed, in can be nil for loaders
+// that only publish. Published invalidations are delivered to the subscribers
+// and sent to out, which can be nil for feeds such as change-data-capture that
+// already carry every change and don't need loaders to publish their own.
+// Sending to out doesn't block Clear, so out should be buffered, see
+// SetDropHook.
+func NewChannelBus[CacheKeyT any](in <-chan Invalidation[CacheKeyT], out chan<- Invalidation[CacheKeyT]) *ChannelBus[CacheKeyT] {
+	b := &ChannelBus[CacheKeyT]{
+		out:       out,
+		MemoryBus: NewMemoryBus[CacheKeyT](),
+	}
+	// receiving from a nil channel blocks forever, which would leak the goroutine
+	if in != nil {
+		go func() {
+			for invalidation := range in {
+				b.MemoryBus.Publish(invalidation)
+			}
+		}()
+	}
+	return b
+}
+
+// SetDropHook sets the function called with the invalidations that were
+// dropped because out wasn't ready to receive them, so they can be logged or
+// retried. It must be called before the bus is first used.
+func (b *ChannelBus[CacheKeyT]) SetDropHook(hook func(Invalidation[CacheKeyT])) {
+	b.onDropped = hook
+}
+
+// Publish implements Bus
+func (b *ChannelBus[CacheKeyT]) Publish(invalidation Invalidation[CacheKeyT]) {
+	b.MemoryBus.Publish(invalidation)
+	if b.out == nil {
+		return
+	}
+	select {
+	case b.out <- invalidation:
+	default:
+		if b.onDropped != nil {
+			b.onDropped(invalidation)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package dataloadgen_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidationBus(t *testing.T) {
+	// the value changes with every fetch
+	fetch := func(ctx context.Context, call int, keys []int) (map[int]string, error) {
+		results := make(map[int]string, len(keys))
+		for _, key := range keys {
+			results[key] = fmt.Sprint(key, " v", call)
+		}
+		return results, nil
+	}
+	newInstance := func(bus dataloadgen.Bus[int]) (*dataloadgen.Loader[int, string], func() [][]int) {
+		dl, fetches := RecordingLoader(fetch, dataloadgen.WithWait(time.Millisecond))
+		dl.SetInvalidationBus(bus)
+		return dl, fetches
+	}
+
+	t.Run("memory bus", func(t *testing.T) {
+		bus := dataloadgen.NewMemoryBus[int]()
+		first, _ := newInstance(bus)
+		second, secondFetches := newInstance(bus)
+		third, thirdFetches := newInstance(bus)
+
+		_, errs := second.LoadAll([]int{1, 2})
+		require.Nil(t, errs)
+		_, errs = third.LoadAll([]int{1, 2})
+		require.Nil(t, errs)
+
+		first.Clear(1)
+		value, err := second.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "1 v2", value)
+		value, err = second.Load(2)
+		require.NoError(t, err)
+		require.Equal(t, "2 v1", value)
+		require.Len(t, secondFetches(), 2)
+
+		third.Close()
+		first.ClearAll()
+		value, err = second.Load(2)
+		require.NoError(t, err)
+		require.Equal(t, "2 v3", value)
+		value, err = third.Load(2)
+		require.NoError(t, err)
+		require.Equal(t, "2 v1", value)
+		require.Len(t, thirdFetches(), 1)
+	})
+
+	t.Run("change data capture feed", func(t *testing.T) {
+		feed := make(chan dataloadgen.Invalidation[int])
+		bus := dataloadgen.NewChannelBus(feed, nil)
+		dl, fetches := newInstance(bus)
+
+		value, err := dl.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "1 v1", value)
+
+		feed <- dataloadgen.Invalidation[int]{Keys: []int{1}}
+		require.Eventually(t, func() bool {
+			value, err := dl.Load(1)
+			return err == nil && value == "1 v2"
+		}, time.Second, time.Millisecond)
+		require.Len(t, fetches(), 2)
+		close(feed)
+	})
+
+	t.Run("publishing to a channel", func(t *testing.T) {
+		out := make(chan dataloadgen.Invalidation[int], 1)
+		bus := dataloadgen.NewChannelBus(nil, out)
+		dl, _ := newInstance(bus)
+		dl.Clear(3)
+		require.Equal(t, dataloadgen.Invalidation[int]{Keys: []int{3}}, <-out)
+	})
+
+	t.Run("publishing to local subscribers", func(t *testing.T) {
+		feed := make(chan dataloadgen.Invalidation[int])
+		defer close(feed)
+		bus := dataloadgen.NewChannelBus(feed, nil)
+		first, _ := newInstance(bus)
+		second, _ := newInstance(bus)
+
+		value, err := second.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "1 v1", value)
+		first.Clear(1)
+		value, err = second.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "1 v2", value)
+	})
+
+	t.Run("dropping invalidations out can't receive", func(t *testing.T) {
+		out := make(chan dataloadgen.Invalidation[int])
+		bus := dataloadgen.NewChannelBus(nil, out)
+		var dropped []dataloadgen.Invalidation[int]
+		bus.SetDropHook(func(invalidation dataloadgen.Invalidation[int]) {
+			dropped = append(dropped, invalidation)
+		})
+		dl, _ := newInstance(bus)
+		dl.Clear(3)
+		dl.ClearAll()
+		require.Equal(t, []dataloadgen.Invalidation[int]{{Keys: []int{3}}, {All: true}}, dropped)
+	})
+}
@@ -0,0 +1,30 @@
+package dataloadgen
+
+import "context"
+
+// FetchFunc fetches the data for a batch of keys. ctx is the context of the
+// batch.
+type FetchFunc[KeyT any, CacheKeyT comparable, ValueT any] func(ctx context.Context, keys []KeyT) (map[CacheKeyT]ValueT, error)
+
+// Middleware decorates a fetch with cross-cutting behavior such as logging,
+// tenant scoping or authorization filtering. It receives the next fetch in the
+// chain and returns a fetch that calls it, or short circuits it. Middleware for
+// a Loader has the same KeyT and CacheKeyT. Middleware written as generic
+// functions can be shared across all loaders.
+type Middleware[KeyT any, CacheKeyT comparable, ValueT any] func(next FetchFunc[KeyT, CacheKeyT, ValueT]) FetchFunc[KeyT, CacheKeyT, ValueT]
+
+// SetMiddleware wraps the fetch of the loader in middleware, replacing any
+// middleware set before. The first middleware is the outermost.
+//
+// Middleware is set on the loader rather than passed to NewLoader as an
+// Option, because Options don't know the types of the loader and middleware of
+// the wrong types could only fail when the loader is created. SetMiddleware
+// isn't synchronized with loads, so it must be called before the loader is
+// first used.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) SetMiddleware(middleware ...Middleware[KeyT, CacheKeyT, ValueT]) {
+	next := l.unwrapped
+	for i := len(middleware) - 1; i >= 0; i-- {
+		next = middleware[i](next)
+	}
+	l.fetch = next
+}
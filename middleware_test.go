@@ -0,0 +1,85 @@
+package dataloadgen_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+// recordBatches is middleware that can be shared by loaders of any type
+func recordBatches[KeyT any, CacheKeyT comparable, ValueT any](mu *sync.Mutex, log *[]string) dataloadgen.Middleware[KeyT, CacheKeyT, ValueT] {
+	return func(next dataloadgen.FetchFunc[KeyT, CacheKeyT, ValueT]) dataloadgen.FetchFunc[KeyT, CacheKeyT, ValueT] {
+		return func(ctx context.Context, keys []KeyT) (map[CacheKeyT]ValueT, error) {
+			results, err := next(ctx, keys)
+			mu.Lock()
+			*log = append(*log, fmt.Sprintf("fetched %v, got %d results", keys, len(results)))
+			mu.Unlock()
+			return results, err
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var mu sync.Mutex
+	var log []string
+
+	forbidden := errors.New("forbidden")
+	// authorize removes keys the caller may not see before they reach fetch
+	authorize := func(next dataloadgen.FetchFunc[int, int, string]) dataloadgen.FetchFunc[int, int, string] {
+		return func(ctx context.Context, keys []int) (map[int]string, error) {
+			var allowed []int
+			errs := dataloadgen.ErrorMap[int]{}
+			for _, key := range keys {
+				if key < 0 {
+					errs[key] = forbidden
+				} else {
+					allowed = append(allowed, key)
+				}
+			}
+			results, err := next(ctx, allowed)
+			if err != nil {
+				return nil, err
+			}
+			return results, errs
+		}
+	}
+
+	numbers := dataloadgen.NewLoader(func(keys []int) (map[int]string, error) {
+		results := make(map[int]string, len(keys))
+		for _, key := range keys {
+			results[key] = fmt.Sprint(key)
+		}
+		return results, nil
+	}, dataloadgen.WithWait(time.Millisecond))
+	numbers.SetMiddleware(recordBatches[int, int, string](&mu, &log), authorize)
+	lengths := dataloadgen.NewLoader(func(keys []string) (map[string]int, error) {
+		results := make(map[string]int, len(keys))
+		for _, key := range keys {
+			results[key] = len(key)
+		}
+		return results, nil
+	}, dataloadgen.WithWait(time.Millisecond))
+	lengths.SetMiddleware(recordBatches[string, string, int](&mu, &log))
+
+	values, errs := numbers.LoadAll([]int{1, -2, 3})
+	require.Equal(t, []string{"1", "", "3"}, values)
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], forbidden)
+	require.NoError(t, errs[2])
+
+	length, err := lengths.Load("four")
+	require.NoError(t, err)
+	require.Equal(t, 4, length)
+
+	// the logging middleware is outermost, so it sees every key
+	require.Equal(t, []string{
+		"fetched [1 -2 3], got 2 results",
+		"fetched [four], got 1 results",
+	}, log)
+}
@@ -0,0 +1,85 @@
+package dataloadgen
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// WithNegativeCache limits how long keys that resolved to ErrNotFound stay
+// cached, and how many of them are cached at once. Once ttl has passed, the
+// next load of the key fetches it again. Once more than max keys are cached as
+// not found, the oldest are evicted, so loading random keys can't grow the
+// cache unboundedly. A ttl or max of 0 means no limit. Successful results are
+// cached as usual.
+func WithNegativeCache(ttl time.Duration, max int) Option {
+	return func(l *loaderConfig) {
+		l.negativeTTL = ttl
+		l.maxNegative = max
+	}
+}
+
+// negativeCache tracks the cached results that resolved to ErrNotFound, oldest
+// first. Entries that were cleared or replaced since are dropped once they
+// reach the front, so the number of entries is an upper bound on the number of
+// negative results still cached.
+type negativeCache[CacheKeyT comparable, ValueT any] struct {
+	entries []negativeEntry[CacheKeyT, ValueT]
+
+	// mutex to prevent races on entries
+	mu sync.Mutex
+}
+
+type negativeEntry[CacheKeyT comparable, ValueT any] struct {
+	cacheKey CacheKeyT
+	result   *Future[ValueT]
+}
+
+// isNegative reports whether the error is a result WithNegativeCache applies to
+func isNegative(err error) bool {
+	return err != nil && errors.Is(err, ErrNotFound)
+}
+
+// expired reports whether the cached result is a negative result past its ttl
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) expired(r *Future[ValueT]) bool {
+	// expires is written before the future is resolved, so it may only be read
+	// once it is
+	return l.negativeTTL > 0 && r.Ready() && r.expires != 0 && time.Now().UnixNano() >= r.expires
+}
+
+// trackNegatives records the negative results among the resolved entries, then
+// evicts the oldest negative results that are expired or over the limit
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) trackNegatives(entries []batchEntry[CacheKeyT, ValueT]) {
+	if l.noCache || (l.negativeTTL == 0 && l.maxNegative == 0) {
+		return
+	}
+	n := &l.negatives
+	n.mu.Lock()
+	for _, e := range entries {
+		if isNegative(e.result.err) {
+			n.entries = append(n.entries, negativeEntry[CacheKeyT, ValueT]{cacheKey: e.cacheKey, result: e.result})
+		}
+	}
+	now := time.Now().UnixNano()
+	var drop int
+	for drop < len(n.entries) {
+		expires := n.entries[drop].result.expires
+		if (l.maxNegative == 0 || len(n.entries)-drop <= l.maxNegative) && (expires == 0 || now < expires) {
+			break
+		}
+		drop++
+	}
+	evicted := make([]negativeEntry[CacheKeyT, ValueT], drop)
+	copy(evicted, n.entries)
+	n.entries = n.entries[drop:]
+	n.mu.Unlock()
+
+	for _, e := range evicted {
+		s := l.shard(e.cacheKey)
+		s.mu.Lock()
+		if r, ok := s.load(e.cacheKey); ok && r == e.result {
+			s.delete(e.cacheKey)
+		}
+		s.mu.Unlock()
+	}
+}
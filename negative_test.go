@@ -0,0 +1,64 @@
+package dataloadgen_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegativeCache(t *testing.T) {
+	// only odd keys are found
+	fetch := func(ctx context.Context, call int, keys []int) (map[int]string, error) {
+		results := make(map[int]string, len(keys))
+		for _, key := range keys {
+			if key%2 == 1 {
+				results[key] = fmt.Sprint(key)
+			}
+		}
+		return results, nil
+	}
+
+	t.Run("negative results expire", func(t *testing.T) {
+		dl, fetches := RecordingLoader(fetch, dataloadgen.WithWait(time.Millisecond), dataloadgen.WithNegativeCache(20*time.Millisecond, 0))
+		_, errs := dl.LoadAll([]int{1, 2})
+		require.ErrorIs(t, errs[1], dataloadgen.ErrNotFound)
+		require.Equal(t, [][]int{{1, 2}}, fetches())
+
+		_, err := dl.Load(2)
+		require.ErrorIs(t, err, dataloadgen.ErrNotFound)
+		require.Len(t, fetches(), 1)
+
+		time.Sleep(30 * time.Millisecond)
+		values, errs := dl.LoadAll([]int{1, 2})
+		require.Equal(t, "1", values[0])
+		require.ErrorIs(t, errs[1], dataloadgen.ErrNotFound)
+		require.Equal(t, [][]int{{1, 2}, {2}}, fetches())
+	})
+
+	t.Run("number of negative results is bounded", func(t *testing.T) {
+		dl, fetches := RecordingLoader(fetch, dataloadgen.WithWait(time.Millisecond), dataloadgen.WithNegativeCache(0, 2))
+		for _, key := range []int{2, 4, 6, 1} {
+			_, _ = dl.Load(key)
+		}
+		require.Equal(t, [][]int{{2}, {4}, {6}, {1}}, fetches())
+
+		// 2 was evicted to make room for 6, successful results don't count
+		values, errs := dl.LoadAll([]int{1, 2, 4, 6})
+		require.Equal(t, "1", values[0])
+		require.ErrorIs(t, errs[1], dataloadgen.ErrNotFound)
+		require.Equal(t, [][]int{{2}, {4}, {6}, {1}, {2}}, fetches())
+	})
+
+	t.Run("evicting a cleared result keeps the key refetched since", func(t *testing.T) {
+		dl, fetches := RecordingLoader(fetch, dataloadgen.WithWait(time.Millisecond), dataloadgen.WithNegativeCache(0, 1))
+		_, _ = dl.Load(2)
+		dl.Clear(2)
+		_, _ = dl.Load(2)
+		_, _ = dl.Load(2)
+		require.Equal(t, [][]int{{2}, {2}}, fetches())
+	})
+}
@@ -0,0 +1,42 @@
+package dataloadgen
+
+// Partitioning routes the keys of a loader into separate batches by class, see
+// PartitionBy
+type Partitioning[KeyT any] struct {
+	partition    func(key KeyT) any
+	classOptions map[any][]Option
+}
+
+// PartitionBy routes keys into separate batches by the class partition returns
+// for them, such as their tenant, shard or region. Batches of different classes
+// are collected and fetched concurrently, so fetch can assume all keys it is
+// called with share a class, and slow classes don't delay others. classOptions
+// configures the batches of each class, only WithWait, WithBatchCapacity and
+// WithMaxBatchWeight apply; classes without options use the settings of the
+// loader. Pass the result to SetPartition.
+func PartitionBy[KeyT any, ClassT comparable](partition func(key KeyT) ClassT, classOptions map[ClassT][]Option) Partitioning[KeyT] {
+	p := Partitioning[KeyT]{
+		partition: func(key KeyT) any {
+			return partition(key)
+		},
+		classOptions: make(map[any][]Option, len(classOptions)),
+	}
+	for class, options := range classOptions {
+		p.classOptions[class] = options
+	}
+	return p
+}
+
+// SetPartition batches the keys of the loader separately by class, see
+// PartitionBy
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) SetPartition(p Partitioning[KeyT]) {
+	l.partition = p.partition
+	l.partitions = make(map[any]*loaderConfig, len(p.classOptions))
+	for class, options := range p.classOptions {
+		config := *l.loaderConfig
+		for _, o := range options {
+			o(&config)
+		}
+		l.partitions[class] = &config
+	}
+}
@@ -0,0 +1,67 @@
+package dataloadgen_test
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+type tenantKey struct {
+	Tenant string
+	ID     int
+}
+
+func TestPartition(t *testing.T) {
+	var mu sync.Mutex
+	var fetches [][]tenantKey
+	release := make(chan struct{})
+	dl := dataloadgen.NewLoader(func(keys []tenantKey) (map[tenantKey]string, error) {
+		mu.Lock()
+		fetches = append(fetches, keys)
+		mu.Unlock()
+		if keys[0].Tenant == "slow" {
+			<-release
+		}
+		results := make(map[tenantKey]string, len(keys))
+		for _, key := range keys {
+			results[key] = fmt.Sprint(key.Tenant, key.ID)
+		}
+		return results, nil
+	}, dataloadgen.WithWait(time.Millisecond))
+	dl.SetPartition(dataloadgen.PartitionBy(func(key tenantKey) string {
+		return key.Tenant
+	}, map[string][]dataloadgen.Option{
+		"small": {dataloadgen.WithBatchCapacity(2)},
+	}))
+
+	slow := dl.LoadAllThunk([]tenantKey{{"slow", 1}, {"slow", 2}})
+	values, errs := dl.LoadAll([]tenantKey{{"small", 1}, {"small", 2}, {"small", 3}, {"big", 1}, {"big", 2}, {"big", 3}})
+	require.Nil(t, errs)
+	require.Equal(t, []string{"small1", "small2", "small3", "big1", "big2", "big3"}, values)
+
+	// the slow tenant's batch is still being fetched
+	close(release)
+	values, errs = slow()
+	require.Equal(t, []string{"slow1", "slow2"}, values)
+	require.Equal(t, []error{nil, nil}, errs)
+
+	sizes := map[string][]int{}
+	for _, keys := range fetches {
+		for _, key := range keys {
+			require.Equal(t, keys[0].Tenant, key.Tenant, "batches must not mix tenants")
+		}
+		sizes[keys[0].Tenant] = append(sizes[keys[0].Tenant], len(keys))
+	}
+	// the batches of a LoadAll are fetched in parallel
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes["small"])))
+	require.Equal(t, map[string][]int{
+		"slow":  {2},
+		"small": {2, 1},
+		"big":   {3},
+	}, sizes)
+}
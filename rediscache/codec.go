@@ -0,0 +1,49 @@
+package rediscache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec encodes values to store them in Redis
+type Codec[ValueT any] interface {
+	Encode(value ValueT) ([]byte, error)
+	Decode(data []byte) (ValueT, error)
+}
+
+// JSON returns a Codec encoding values with encoding/json
+func JSON[ValueT any]() Codec[ValueT] {
+	return jsonCodec[ValueT]{}
+}
+
+type jsonCodec[ValueT any] struct{}
+
+func (jsonCodec[ValueT]) Encode(value ValueT) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonCodec[ValueT]) Decode(data []byte) (ValueT, error) {
+	var value ValueT
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
+
+// Gob returns a Codec encoding values with encoding/gob
+func Gob[ValueT any]() Codec[ValueT] {
+	return gobCodec[ValueT]{}
+}
+
+type gobCodec[ValueT any] struct{}
+
+func (gobCodec[ValueT]) Encode(value ValueT) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&value)
+	return buf.Bytes(), err
+}
+
+func (gobCodec[ValueT]) Decode(data []byte) (ValueT, error) {
+	var value ValueT
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
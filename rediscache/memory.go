@@ -0,0 +1,61 @@
+package rediscache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryClient is an in-process stand-in for Redis implementing Client, meant
+// for tests. Expired values are removed when they are read.
+type MemoryClient struct {
+	values map[string]memoryValue
+
+	mu sync.Mutex
+}
+
+type memoryValue struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewMemoryClient creates a new empty MemoryClient
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		values: map[string]memoryValue{},
+	}
+}
+
+// MGet implements Client
+func (m *MemoryClient) MGet(ctx context.Context, keys []string) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		value, ok := m.values[key]
+		if !ok {
+			continue
+		}
+		if !value.expires.IsZero() && !now.Before(value.expires) {
+			delete(m.values, key)
+			continue
+		}
+		values[i] = value.data
+	}
+	return values, nil
+}
+
+// MSet implements Client
+func (m *MemoryClient) MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	for key, data := range values {
+		m.values[key] = memoryValue{data: data, expires: expires}
+	}
+	return nil
+}
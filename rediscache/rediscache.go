@@ -0,0 +1,192 @@
+// Package rediscache provides a Redis-backed second-level cache for
+// dataloadgen loaders, shared by every instance of a service.
+//
+// The cache is installed as fetch middleware: before a batch is fetched, all its
+// keys are looked up in Redis with a single MGET, and only the keys that missed
+// are passed to fetch. The values fetch returns for keys without an error are
+// written back with their TTL, so the next instance to load them doesn't have
+// to fetch them again.
+//
+// The package doesn't depend on a Redis client. Client is small enough to be
+// implemented on top of any of them, and MemoryClient is an in-process stand-in
+// for tests.
+package rediscache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+)
+
+// Client is the subset of Redis commands the cache needs
+type Client interface {
+	// MGet returns the values stored at keys, in the same order, with nil for
+	// keys that don't exist
+	MGet(ctx context.Context, keys []string) ([][]byte, error)
+
+	// MSet stores values by key, expiring them after ttl. A ttl of 0 means the
+	// values don't expire. With Redis this is a pipeline of SET commands with
+	// the EX or PX option, since MSET doesn't support expiry.
+	MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error
+}
+
+// Option allows for configuration of cache fields.
+type Option func(*cacheConfig)
+
+// WithTTL sets how long values stay in Redis. Default is 0 (no expiry)
+func WithTTL(ttl time.Duration) Option {
+	return func(c *cacheConfig) {
+		c.ttl = ttl
+	}
+}
+
+// WithPrefix sets the prefix of the Redis keys, which should be unique per
+// loader. Default is no prefix
+func WithPrefix(prefix string) Option {
+	return func(c *cacheConfig) {
+		c.prefix = prefix
+	}
+}
+
+// WithErrorHandler sets a function called with errors from Redis and the codec.
+// These errors never fail a load: keys that can't be read from Redis are
+// fetched instead, and values that can't be written are only missing from Redis.
+func WithErrorHandler(onError func(error)) Option {
+	return func(c *cacheConfig) {
+		c.onError = onError
+	}
+}
+
+type cacheConfig struct {
+	// how long values stay in Redis, 0 = no expiry
+	ttl time.Duration
+
+	// prepended to the keys of the loader to make Redis keys
+	prefix string
+
+	// called with errors that were recovered from
+	onError func(error)
+}
+
+// Cache is a Redis-backed cache for a dataloadgen.Loader
+type Cache[KeyT comparable, ValueT any] struct {
+	client Client
+	codec  Codec[ValueT]
+	cacheConfig
+}
+
+// New creates a new Cache that stores values in client, encoded with codec.
+// Redis keys are the keys of the loader formatted with fmt.Sprint, after the
+// prefix.
+func New[KeyT comparable, ValueT any](client Client, codec Codec[ValueT], options ...Option) *Cache[KeyT, ValueT] {
+	c := &Cache[KeyT, ValueT]{
+		client: client,
+		codec:  codec,
+	}
+	for _, o := range options {
+		o(&c.cacheConfig)
+	}
+	return c
+}
+
+// Middleware returns the fetch middleware that reads values from the cache
+// before calling fetch and writes fetched values to it. Pass it to the loader
+// with SetMiddleware.
+func (c *Cache[KeyT, ValueT]) Middleware() dataloadgen.Middleware[KeyT, KeyT, ValueT] {
+	return func(next dataloadgen.FetchFunc[KeyT, KeyT, ValueT]) dataloadgen.FetchFunc[KeyT, KeyT, ValueT] {
+		return func(ctx context.Context, keys []KeyT) (map[KeyT]ValueT, error) {
+			results, misses := c.get(ctx, keys)
+			if len(misses) == 0 {
+				return results, nil
+			}
+
+			fetched, err := next(ctx, misses)
+			c.set(ctx, fetched, err)
+			if results == nil {
+				return fetched, err
+			}
+			for key, value := range fetched {
+				results[key] = value
+			}
+			return results, err
+		}
+	}
+}
+
+// get looks up all the keys in Redis and returns the values that were found
+// and the keys that weren't
+func (c *Cache[KeyT, ValueT]) get(ctx context.Context, keys []KeyT) (map[KeyT]ValueT, []KeyT) {
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = c.redisKey(key)
+	}
+	values, err := c.client.MGet(ctx, redisKeys)
+	if err == nil && len(values) != len(keys) {
+		err = fmt.Errorf("rediscache: MGET returned %d values for %d keys", len(values), len(keys))
+	}
+	if err != nil {
+		c.error(err)
+		return nil, keys
+	}
+
+	var results map[KeyT]ValueT
+	var misses []KeyT
+	for i, key := range keys {
+		if values[i] == nil {
+			misses = append(misses, key)
+			continue
+		}
+		value, err := c.codec.Decode(values[i])
+		if err != nil {
+			c.error(fmt.Errorf("rediscache: decoding %s: %w", redisKeys[i], err))
+			misses = append(misses, key)
+			continue
+		}
+		if results == nil {
+			results = make(map[KeyT]ValueT, len(keys))
+		}
+		results[key] = value
+	}
+	return results, misses
+}
+
+// set writes fetched values to Redis. Keys with an error in the ErrorMap of
+// fetch are left out, and nothing is written if fetch returned any other error,
+// since the values may be incomplete or wrong.
+func (c *Cache[KeyT, ValueT]) set(ctx context.Context, fetched map[KeyT]ValueT, fetchErr error) {
+	var errs dataloadgen.ErrorMap[KeyT]
+	if fetchErr != nil && !errors.As(fetchErr, &errs) {
+		return
+	}
+	values := make(map[string][]byte, len(fetched))
+	for key, value := range fetched {
+		if _, failed := errs[key]; failed {
+			continue
+		}
+		data, err := c.codec.Encode(value)
+		if err != nil {
+			c.error(fmt.Errorf("rediscache: encoding %v: %w", key, err))
+			continue
+		}
+		values[c.redisKey(key)] = data
+	}
+	if len(values) == 0 {
+		return
+	}
+	if err := c.client.MSet(ctx, values, c.ttl); err != nil {
+		c.error(err)
+	}
+}
+
+func (c *Cache[KeyT, ValueT]) redisKey(key KeyT) string {
+	return c.prefix + fmt.Sprint(key)
+}
+
+func (c *Cache[KeyT, ValueT]) error(err error) {
+	if c.onError != nil {
+		c.onError(err)
+	}
+}
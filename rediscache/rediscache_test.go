@@ -0,0 +1,140 @@
+package rediscache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/mshaeon/dataloadgen/rediscache"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	ID   int
+	Name string
+}
+
+// newInstance creates the loader of one instance of a service, recording the
+// keys it fetches
+func newInstance(client rediscache.Client, codec rediscache.Codec[user], fetches *[][]int, options ...rediscache.Option) *dataloadgen.Loader[int, user] {
+	var mu sync.Mutex
+	cache := rediscache.New[int, user](client, codec, append(options, rediscache.WithPrefix("user:"))...)
+	dl := dataloadgen.NewLoader(func(keys []int) (map[int]user, error) {
+		mu.Lock()
+		*fetches = append(*fetches, keys)
+		mu.Unlock()
+		results := make(map[int]user, len(keys))
+		errs := dataloadgen.ErrorMap[int]{}
+		for _, key := range keys {
+			if key < 0 {
+				errs[key] = errors.New("forbidden")
+				continue
+			}
+			results[key] = user{ID: key, Name: fmt.Sprint("user ", key)}
+		}
+		return results, errs
+	}, dataloadgen.WithWait(time.Millisecond))
+	dl.SetMiddleware(cache.Middleware())
+	return dl
+}
+
+// newFailingInstance creates the loader of an instance whose fetch returns
+// values for keys 1 and 2 along with fetchErr
+func newFailingInstance(client rediscache.Client, fetchErr error) *dataloadgen.Loader[int, user] {
+	cache := rediscache.New[int, user](client, rediscache.JSON[user](), rediscache.WithPrefix("user:"))
+	dl := dataloadgen.NewLoader(func(keys []int) (map[int]user, error) {
+		return map[int]user{1: {1, "user 1"}, 2: {2, "stale 2"}}, fetchErr
+	}, dataloadgen.WithWait(time.Millisecond))
+	dl.SetMiddleware(cache.Middleware())
+	return dl
+}
+
+func TestCache(t *testing.T) {
+	for name, codec := range map[string]rediscache.Codec[user]{
+		"json": rediscache.JSON[user](),
+		"gob":  rediscache.Gob[user](),
+	} {
+		codec := codec
+		t.Run(name, func(t *testing.T) {
+			client := rediscache.NewMemoryClient()
+
+			var firstFetches [][]int
+			first := newInstance(client, codec, &firstFetches)
+			values, errs := first.LoadAll([]int{1, 2, -3})
+			require.Equal(t, []user{{1, "user 1"}, {2, "user 2"}, {}}, values)
+			require.EqualError(t, errs[2], "forbidden")
+			require.Equal(t, [][]int{{1, 2, -3}}, firstFetches)
+
+			// another instance only fetches the keys that aren't in redis
+			var secondFetches [][]int
+			second := newInstance(client, codec, &secondFetches)
+			values, errs = second.LoadAll([]int{2, -3, 4, 1})
+			require.Equal(t, []user{{2, "user 2"}, {}, {4, "user 4"}, {1, "user 1"}}, values)
+			require.EqualError(t, errs[1], "forbidden")
+			require.Equal(t, [][]int{{-3, 4}}, secondFetches)
+		})
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	client := rediscache.NewMemoryClient()
+	var fetches [][]int
+	first := newInstance(client, rediscache.JSON[user](), &fetches, rediscache.WithTTL(20*time.Millisecond))
+	_, err := first.Load(1)
+	require.NoError(t, err)
+
+	time.Sleep(30 * time.Millisecond)
+	second := newInstance(client, rediscache.JSON[user](), &fetches)
+	_, err = second.Load(1)
+	require.NoError(t, err)
+	require.Equal(t, [][]int{{1}, {1}}, fetches)
+}
+
+func TestCacheSkipsFailedKeys(t *testing.T) {
+	// values fetch returned alongside an error must not be shared with other
+	// instances
+	ctx := context.Background()
+
+	t.Run("keys in the ErrorMap", func(t *testing.T) {
+		client := rediscache.NewMemoryClient()
+		newFailingInstance(client, dataloadgen.ErrorMap[int]{2: errors.New("stale")}).LoadAll([]int{1, 2})
+		values, err := client.MGet(ctx, []string{"user:1", "user:2"})
+		require.NoError(t, err)
+		require.NotNil(t, values[0])
+		require.Nil(t, values[1])
+	})
+
+	t.Run("any other error", func(t *testing.T) {
+		client := rediscache.NewMemoryClient()
+		newFailingInstance(client, errors.New("partial failure")).LoadAll([]int{1, 2})
+		values, err := client.MGet(ctx, []string{"user:1", "user:2"})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{nil, nil}, values)
+	})
+}
+
+type failingClient struct{}
+
+func (failingClient) MGet(ctx context.Context, keys []string) ([][]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingClient) MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func TestCacheErrors(t *testing.T) {
+	var errs []error
+	var fetches [][]int
+	dl := newInstance(failingClient{}, rediscache.JSON[user](), &fetches, rediscache.WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	value, err := dl.Load(1)
+	require.NoError(t, err)
+	require.Equal(t, user{1, "user 1"}, value)
+	require.Len(t, errs, 2)
+}
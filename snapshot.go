@@ -0,0 +1,108 @@
+package dataloadgen
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// SnapshotEntry is a resolved cache entry as it is written to a snapshot
+type SnapshotEntry[CacheKeyT, ValueT any] struct {
+	Key   CacheKeyT
+	Value ValueT
+}
+
+// SnapshotCodec creates the encoders writing snapshot entries to a stream, and
+// the decoders reading them back. See GobSnapshots and JSONSnapshots.
+type SnapshotCodec interface {
+	NewEncoder(w io.Writer) SnapshotEncoder
+	NewDecoder(r io.Reader) SnapshotDecoder
+}
+
+// SnapshotEncoder writes values to a stream one after the other
+type SnapshotEncoder interface {
+	Encode(value any) error
+}
+
+// SnapshotDecoder reads the values of a stream one after the other, returning
+// io.EOF once the stream is exhausted
+type SnapshotDecoder interface {
+	Decode(value any) error
+}
+
+// GobSnapshots encodes snapshots with encoding/gob
+var GobSnapshots SnapshotCodec = gobSnapshots{}
+
+type gobSnapshots struct{}
+
+func (gobSnapshots) NewEncoder(w io.Writer) SnapshotEncoder {
+	return gob.NewEncoder(w)
+}
+
+func (gobSnapshots) NewDecoder(r io.Reader) SnapshotDecoder {
+	return gob.NewDecoder(r)
+}
+
+// JSONSnapshots encodes snapshots with encoding/json, one entry per line
+var JSONSnapshots SnapshotCodec = jsonSnapshots{}
+
+type jsonSnapshots struct{}
+
+func (jsonSnapshots) NewEncoder(w io.Writer) SnapshotEncoder {
+	return json.NewEncoder(w)
+}
+
+func (jsonSnapshots) NewDecoder(r io.Reader) SnapshotDecoder {
+	return json.NewDecoder(r)
+}
+
+// Export writes the resolved entries of the cache to w, encoded with codec, and
+// returns the number of entries written. Keys that are still being fetched and
+// keys that resolved to an error are left out. Shards are exported one after
+// the other, so loads running concurrently may or may not be included.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) Export(w io.Writer, codec SnapshotCodec) (int, error) {
+	enc := codec.NewEncoder(w)
+	var written int
+	var entries []SnapshotEntry[CacheKeyT, ValueT]
+	for i := range l.shards {
+		// entries are copied so writing to w doesn't block loads of the shard
+		s := &l.shards[i]
+		s.mu.Lock()
+		s.each(func(cacheKey CacheKeyT, r *Future[ValueT]) {
+			if r.Ready() && r.err == nil {
+				entries = append(entries, SnapshotEntry[CacheKeyT, ValueT]{Key: cacheKey, Value: r.value})
+			}
+		})
+		s.mu.Unlock()
+
+		for j := range entries {
+			if err := enc.Encode(&entries[j]); err != nil {
+				return written, err
+			}
+			written++
+		}
+		entries = entries[:0]
+	}
+	return written, nil
+}
+
+// Import primes the cache with the entries read from r, decoded with codec, such
+// as a snapshot written by Export before a restart. Like Prime, keys that
+// already exist are left unchanged. It returns the number of keys primed.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) Import(r io.Reader, codec SnapshotCodec) (int, error) {
+	dec := codec.NewDecoder(r)
+	var primed int
+	for {
+		var entry SnapshotEntry[CacheKeyT, ValueT]
+		if err := dec.Decode(&entry); err != nil {
+			if errors.Is(err, io.EOF) {
+				return primed, nil
+			}
+			return primed, err
+		}
+		if l.prime(entry.Key, &Future[ValueT]{value: entry.Value, done: closed}, false) {
+			primed++
+		}
+	}
+}
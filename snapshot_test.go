@@ -0,0 +1,75 @@
+package dataloadgen_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	// only odd keys are found, and fetching 3 waits until release is closed
+	fetchUsers := func(release chan struct{}) func(ctx context.Context, call int, keys []int) (map[int]benchmarkUser, error) {
+		return func(ctx context.Context, call int, keys []int) (map[int]benchmarkUser, error) {
+			results := make(map[int]benchmarkUser, len(keys))
+			for _, key := range keys {
+				if key == 3 {
+					<-release
+				}
+				if key%2 == 1 {
+					results[key] = benchmarkUser{ID: fmt.Sprint(key), Name: fmt.Sprint("user ", key)}
+				}
+			}
+			return results, nil
+		}
+	}
+	options := []dataloadgen.Option{
+		dataloadgen.WithWait(time.Millisecond),
+		dataloadgen.WithShards(4),
+	}
+
+	for name, codec := range map[string]dataloadgen.SnapshotCodec{
+		"gob":  dataloadgen.GobSnapshots,
+		"json": dataloadgen.JSONSnapshots,
+	} {
+		t.Run(name, func(t *testing.T) {
+			release := make(chan struct{})
+			dl, _ := RecordingLoader(fetchUsers(release), options...)
+			_, errs := dl.LoadAll([]int{1, 2})
+			require.Error(t, errs[1])
+			dl.PrimeError(5, errors.New("forbidden"))
+			dl.Prime(7, benchmarkUser{ID: "7", Name: "primed"})
+			pending := dl.LoadThunk(3)
+
+			var buf bytes.Buffer
+			written, err := dl.Export(&buf, codec)
+			require.NoError(t, err)
+			require.Equal(t, 2, written)
+			close(release)
+			_, err = pending()
+			require.NoError(t, err)
+
+			restored, restoredFetches := RecordingLoader(fetchUsers(release), options...)
+			restored.Prime(7, benchmarkUser{ID: "7", Name: "primed again"})
+			primed, err := restored.Import(&buf, codec)
+			require.NoError(t, err)
+			require.Equal(t, 1, primed)
+
+			values, errs := restored.LoadAll([]int{1, 7})
+			require.Nil(t, errs)
+			require.Equal(t, []benchmarkUser{{ID: "1", Name: "user 1"}, {ID: "7", Name: "primed again"}}, values)
+			require.Empty(t, restoredFetches())
+		})
+	}
+
+	t.Run("corrupt snapshot", func(t *testing.T) {
+		dl, _ := RecordingLoader(fetchUsers(nil), options...)
+		_, err := dl.Import(bytes.NewBufferString(`{"Key": "one"}`), dataloadgen.JSONSnapshots)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,133 @@
+package dataloadgen
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StreamFetchFunc fetches the values of keys like FetchFunc, but publishes
+// every result with emit as soon as it is available, such as while scanning SQL
+// rows or reading a gRPC stream. emit may be called from several goroutines.
+// Keys that are never emitted resolve like keys missing from the result of a
+// FetchFunc: to the returned error if there is one, otherwise as not found.
+type StreamFetchFunc[KeyT any, CacheKeyT comparable, ValueT any] func(ctx context.Context, keys []KeyT, emit func(cacheKey CacheKeyT, value ValueT, err error)) error
+
+// NewStreamLoader creates a new Loader given a streaming fetch. Every key is
+// resolved as soon as fetch emits it, instead of once the whole batch has been
+// fetched, so one slow row doesn't delay every waiter of the batch.
+//
+// Middleware (see SetMiddleware) wraps the whole stream and receives the
+// emitted results once it has ended, so it can't change results that were
+// already emitted. The same goes for WithStrictFetch, which only fails the keys
+// that weren't emitted.
+func NewStreamLoader[KeyT comparable, ValueT any](fetch StreamFetchFunc[KeyT, KeyT, ValueT], options ...Option) *Loader[KeyT, ValueT] {
+	return &Loader[KeyT, ValueT]{
+		NewStreamKeyedLoader(fetch, func(key KeyT) KeyT { return key }, options...),
+	}
+}
+
+// NewStreamKeyedLoader creates a new KeyedLoader like NewKeyedLoader, given a
+// streaming fetch. See NewStreamLoader.
+func NewStreamKeyedLoader[KeyT any, CacheKeyT comparable, ValueT any](fetch StreamFetchFunc[KeyT, CacheKeyT, ValueT], keyFunc func(KeyT) CacheKeyT, options ...Option) *KeyedLoader[KeyT, CacheKeyT, ValueT] {
+	var l *KeyedLoader[KeyT, CacheKeyT, ValueT]
+	l = NewKeyedLoaderContext(func(ctx context.Context, keys []KeyT) (map[CacheKeyT]ValueT, error) {
+		stream, _ := ctx.Value(streamContextKey{l}).(*streamBatch[KeyT, CacheKeyT, ValueT])
+		var mu sync.Mutex
+		data := make(map[CacheKeyT]ValueT, len(keys))
+		errs := ErrorMap[CacheKeyT]{}
+		err := fetch(ctx, keys, func(cacheKey CacheKeyT, value ValueT, err error) {
+			mu.Lock()
+			if err != nil {
+				errs[cacheKey] = err
+			} else {
+				data[cacheKey] = value
+			}
+			mu.Unlock()
+			// once the batch timed out its waiters have their results
+			if stream != nil && ctx.Err() == nil {
+				stream.emit(l, cacheKey, value, err)
+			}
+		})
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil && len(errs) > 0 {
+			err = errs
+		}
+		return data, err
+	}, keyFunc, options...)
+	l.streaming = true
+	return l
+}
+
+// streamContextKey is the key of the streamBatch of a loader in the context of
+// its fetch
+type streamContextKey struct {
+	loader any
+}
+
+// batchContext returns the context the batch is fetched with
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) batchContext(b *loaderBatch[KeyT, CacheKeyT, ValueT]) context.Context {
+	if b.stream == nil {
+		return context.Background()
+	}
+	return context.WithValue(context.Background(), streamContextKey{l}, b.stream)
+}
+
+// streamBatch resolves the keys of a batch one by one as a streaming fetch
+// emits them
+type streamBatch[KeyT any, CacheKeyT comparable, ValueT any] struct {
+	batch *loaderBatch[KeyT, CacheKeyT, ValueT]
+
+	// the position of every key in the batch, and whether it was resolved
+	index    map[CacheKeyT]int
+	resolved []bool
+
+	// mutex to prevent races on resolved
+	mu sync.Mutex
+}
+
+func newStreamBatch[KeyT any, CacheKeyT comparable, ValueT any](b *loaderBatch[KeyT, CacheKeyT, ValueT]) *streamBatch[KeyT, CacheKeyT, ValueT] {
+	index := make(map[CacheKeyT]int, len(b.entries))
+	for i, e := range b.entries {
+		index[e.cacheKey] = i
+	}
+	return &streamBatch[KeyT, CacheKeyT, ValueT]{
+		batch:    b,
+		index:    index,
+		resolved: make([]bool, len(b.entries)),
+	}
+}
+
+// emit resolves the result of the cache key, unless it isn't part of the batch
+// or was already resolved
+func (s *streamBatch[KeyT, CacheKeyT, ValueT]) emit(l *KeyedLoader[KeyT, CacheKeyT, ValueT], cacheKey CacheKeyT, value ValueT, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[cacheKey]
+	if !ok || s.resolved[i] {
+		return
+	}
+	s.resolved[i] = true
+	r := s.batch.entries[i].result
+	r.value, r.err = value, err
+	if l.negativeTTL > 0 && isNegative(err) {
+		r.expires = time.Now().Add(l.negativeTTL).UnixNano()
+	}
+	close(r.done)
+}
+
+// complete resolves the keys that were not emitted with the fetch output, and
+// ignores anything emitted after
+func (s *streamBatch[KeyT, CacheKeyT, ValueT]) complete(l *KeyedLoader[KeyT, CacheKeyT, ValueT], data map[CacheKeyT]ValueT, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.batch
+	b.resolve(l, b.entries, s.resolved, data, err)
+	for i, e := range b.entries {
+		if !s.resolved[i] {
+			s.resolved[i] = true
+			close(e.result.done)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package dataloadgen_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamLoader(t *testing.T) {
+	release := make(chan struct{})
+	dl := dataloadgen.NewStreamLoader(func(ctx context.Context, keys []int, emit func(int, string, error)) error {
+		for _, key := range keys {
+			switch {
+			case key == 3:
+				emit(key, "", errors.New("bad row"))
+			case key%2 == 1:
+				emit(key, fmt.Sprint(key), nil)
+			}
+		}
+		// the last rows are slow to arrive
+		<-release
+		emit(2, "2", nil)
+		return nil
+	}, dataloadgen.WithWait(time.Millisecond))
+
+	one := dl.LoadFuture(1)
+	two := dl.LoadFuture(2)
+	three := dl.LoadFuture(3)
+	four := dl.LoadFuture(4)
+
+	value, err := one.Get()
+	require.NoError(t, err)
+	require.Equal(t, "1", value)
+	_, err = three.Get()
+	require.EqualError(t, err, "bad row")
+	require.False(t, two.Ready())
+	require.False(t, four.Ready())
+
+	close(release)
+	value, err = two.Get()
+	require.NoError(t, err)
+	require.Equal(t, "2", value)
+	_, err = four.Get()
+	require.ErrorIs(t, err, dataloadgen.ErrNotFound)
+
+	t.Run("keys never emitted get the fetch error", func(t *testing.T) {
+		dl := dataloadgen.NewStreamLoader(func(ctx context.Context, keys []int, emit func(int, string, error)) error {
+			emit(1, "1", nil)
+			return errors.New("stream broken")
+		}, dataloadgen.WithWait(time.Millisecond))
+		values, errs := dl.LoadAll([]int{1, 2})
+		require.Equal(t, "1", values[0])
+		require.NoError(t, errs[0])
+		require.EqualError(t, errs[1], "stream broken")
+	})
+
+	t.Run("results emitted after a timeout are ignored", func(t *testing.T) {
+		dl := dataloadgen.NewStreamLoader(func(ctx context.Context, keys []int, emit func(int, string, error)) error {
+			emit(1, "1", nil)
+			<-ctx.Done()
+			emit(2, "2", nil)
+			return ctx.Err()
+		},
+			dataloadgen.WithWait(time.Millisecond),
+			dataloadgen.WithFetchTimeout(10*time.Millisecond),
+		)
+		values, errs := dl.LoadAll([]int{1, 2})
+		require.Equal(t, "1", values[0])
+		require.NoError(t, errs[0])
+		require.ErrorIs(t, errs[1], context.DeadlineExceeded)
+	})
+}
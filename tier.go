@@ -0,0 +1,51 @@
+package dataloadgen
+
+import "errors"
+
+// NewTieredLoader creates a per-request Loader backed by a long-lived shared
+// loader. Keys missing from the per-request cache are loaded from shared, which
+// only calls its fetch for keys missing from the shared cache, so values are
+// reused across requests while each request still sees a consistent snapshot.
+// Prime and Clear on the returned loader only affect the per-request cache. The
+// options configure the per-request loader.
+//
+// If shared is created WithoutCache it acts as a process-wide batch scheduler:
+// keys that many per-request loaders load within the same wait are merged into
+// one fetch, while every request keeps its own cache. Each request also keeps
+// its own semantics for errors and visibility, since keys shared didn't find
+// are resolved by the not found option of the per-request loader, and
+// middleware of the per-request loader can filter the keys it passes on to
+// shared and the results it gets back.
+func NewTieredLoader[KeyT comparable, ValueT any](shared *Loader[KeyT, ValueT], options ...Option) *Loader[KeyT, ValueT] {
+	return &Loader[KeyT, ValueT]{
+		KeyedLoader: NewTieredKeyedLoader(shared.KeyedLoader, options...),
+	}
+}
+
+// NewTieredKeyedLoader creates a per-request KeyedLoader backed by a long-lived
+// shared loader, like NewTieredLoader.
+func NewTieredKeyedLoader[KeyT any, CacheKeyT comparable, ValueT any](shared *KeyedLoader[KeyT, CacheKeyT, ValueT], options ...Option) *KeyedLoader[KeyT, CacheKeyT, ValueT] {
+	return NewKeyedLoader(func(keys []KeyT) (map[CacheKeyT]ValueT, error) {
+		futures := make([]*Future[ValueT], len(keys))
+		for i, key := range keys {
+			futures[i] = shared.load(key)
+		}
+
+		results := make(map[CacheKeyT]ValueT, len(keys))
+		errs := make(ErrorMap[CacheKeyT])
+		for i, key := range keys {
+			cacheKey := shared.keyFunc(key)
+			value, err := futures[i].Get()
+			if errors.Is(err, ErrNotFound) {
+				// left out so the per-request loader decides what it resolves to
+				continue
+			}
+			if err != nil {
+				errs[cacheKey] = err
+				continue
+			}
+			results[cacheKey] = value
+		}
+		return results, errs
+	}, shared.keyFunc, options...)
+}
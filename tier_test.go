@@ -0,0 +1,119 @@
+package dataloadgen_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredLoader(t *testing.T) {
+	var mu sync.Mutex
+	var fetches [][]int
+	shared := dataloadgen.NewLoader(func(keys []int) (map[int]string, error) {
+		mu.Lock()
+		fetches = append(fetches, keys)
+		mu.Unlock()
+		results := make(map[int]string, len(keys))
+		for _, key := range keys {
+			if key > 0 {
+				results[key] = fmt.Sprint(key)
+			}
+		}
+		return results, nil
+	}, dataloadgen.WithWait(time.Millisecond))
+
+	first := dataloadgen.NewTieredLoader(shared, dataloadgen.WithWait(time.Millisecond))
+	values, errs := first.LoadAll([]int{1, 2})
+	require.Nil(t, errs)
+	require.Equal(t, []string{"1", "2"}, values)
+
+	t.Run("misses are resolved from the shared tier", func(t *testing.T) {
+		second := dataloadgen.NewTieredLoader(shared, dataloadgen.WithWait(time.Millisecond))
+		values, errs := second.LoadAll([]int{2, 3, -4})
+		require.Equal(t, []string{"2", "3", ""}, values)
+		require.NoError(t, errs[0])
+		require.NoError(t, errs[1])
+		var notFound *dataloadgen.NotFoundError[int]
+		require.ErrorAs(t, errs[2], &notFound)
+		require.Equal(t, -4, notFound.Key)
+		require.Equal(t, [][]int{{1, 2}, {3, -4}}, fetches)
+	})
+
+	t.Run("Prime and Clear are isolated per request", func(t *testing.T) {
+		first.Clear(1)
+		require.True(t, first.Prime(1, "primed"))
+		value, err := first.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "primed", value)
+
+		other := dataloadgen.NewTieredLoader(shared, dataloadgen.WithWait(time.Millisecond))
+		value, err = other.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "1", value)
+		require.Len(t, fetches, 2)
+	})
+}
+
+func TestSharedBatcher(t *testing.T) {
+	var mu sync.Mutex
+	var fetches [][]int
+	batcher := dataloadgen.NewLoader(func(keys []int) (map[int]string, error) {
+		mu.Lock()
+		fetches = append(fetches, keys)
+		mu.Unlock()
+		results := make(map[int]string, len(keys))
+		for _, key := range keys {
+			if key > 0 {
+				results[key] = fmt.Sprint(key)
+			}
+		}
+		return results, nil
+	},
+		dataloadgen.WithoutCache(),
+		dataloadgen.WithWait(20*time.Millisecond),
+	)
+
+	// the second request may not see odd keys
+	hideOdd := func(next dataloadgen.FetchFunc[int, int, string]) dataloadgen.FetchFunc[int, int, string] {
+		return func(ctx context.Context, keys []int) (map[int]string, error) {
+			results, err := next(ctx, keys)
+			for key := range results {
+				if key%2 == 1 {
+					delete(results, key)
+				}
+			}
+			return results, err
+		}
+	}
+	first := dataloadgen.NewTieredLoader(batcher,
+		dataloadgen.WithWait(time.Millisecond),
+		dataloadgen.WithNotFoundZero(),
+	)
+	second := dataloadgen.NewTieredLoader(batcher, dataloadgen.WithWait(time.Millisecond))
+	second.SetMiddleware(hideOdd)
+
+	firstThunk := first.LoadAllThunk([]int{1, 2, -1})
+	secondThunk := second.LoadAllThunk([]int{2, 3})
+
+	values, errs := firstThunk()
+	require.Equal(t, []string{"1", "2", ""}, values)
+	require.Equal(t, []error{nil, nil, nil}, errs)
+
+	values, errs = secondThunk()
+	require.Equal(t, []string{"2", ""}, values)
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], dataloadgen.ErrNotFound)
+
+	require.Len(t, fetches, 1)
+	require.ElementsMatch(t, []int{1, 2, -1, 3}, fetches[0])
+
+	// the batcher doesn't cache, so a new request fetches again
+	_, err := dataloadgen.NewTieredLoader(batcher, dataloadgen.WithWait(time.Millisecond)).Load(1)
+	require.NoError(t, err)
+	require.Len(t, fetches, 2)
+}
@@ -0,0 +1,108 @@
+package dataloadgen
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WithFetchTimeout limits how long a fetch may take. Once it has taken d, the
+// context of the batch is cancelled and every key waiting on the batch fails
+// with a *FetchTimeoutError. The failed keys are evicted from the cache before
+// waiters are woken up, so they are fetched again by the next load.
+// Default is 0 (no timeout)
+func WithFetchTimeout(d time.Duration) Option {
+	return func(l *loaderConfig) {
+		l.fetchTimeout = d
+	}
+}
+
+// WithLateResults caches the values of fetches that return after timing out
+// (see WithFetchTimeout) for the keys that weren't loaded again in the
+// meantime, so the work of a slow fetch isn't wasted. Keys that failed or that
+// fetch returned no value for aren't cached, and neither is anything of a fetch
+// that returned an error other than an ErrorMap.
+func WithLateResults() Option {
+	return func(l *loaderConfig) {
+		l.lateResults = true
+	}
+}
+
+// FetchTimeoutError is the error of keys whose fetch took longer than the
+// timeout set with WithFetchTimeout. It matches context.DeadlineExceeded with
+// errors.Is.
+type FetchTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *FetchTimeoutError) Error() string {
+	return fmt.Sprintf("dataloadgen: fetch timed out after %s", e.Timeout)
+}
+
+func (e *FetchTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// fetchWithTimeout fetches the batch, failing it if the fetch takes longer than
+// the fetch timeout
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) fetchWithTimeout(b *loaderBatch[KeyT, CacheKeyT, ValueT]) {
+	ctx, cancel := context.WithTimeout(l.batchContext(b), l.fetchTimeout)
+	defer cancel()
+
+	var data map[CacheKeyT]ValueT
+	var err error
+	fetched := make(chan struct{})
+	go func() {
+		data, err = l.fetchBatch(ctx, b)
+		close(fetched)
+	}()
+
+	select {
+	case <-fetched:
+		l.complete(b, data, err)
+		return
+	case <-ctx.Done():
+	}
+
+	// waiters that load the keys again as soon as they wake up must not find
+	// the timeout error in the cache
+	l.evictBatch(b)
+	l.complete(b, nil, &FetchTimeoutError{Timeout: l.fetchTimeout})
+	if !l.lateResults {
+		return
+	}
+	go func() {
+		<-fetched
+		// a fetch that respects its context usually fails with ctx.Err() once
+		// it times out, which must not be cached
+		var em ErrorMap[CacheKeyT]
+		if err != nil {
+			var ok bool
+			if em, ok = asErrorMap[CacheKeyT](err); !ok {
+				return
+			}
+		}
+		// only keys with a value are cached, and keys loaded again since the
+		// timeout keep their newer result
+		for _, e := range b.entries {
+			value, ok := data[e.cacheKey]
+			if !ok || em[e.cacheKey] != nil {
+				continue
+			}
+			l.prime(e.cacheKey, &Future[ValueT]{value: value, done: closed}, false)
+		}
+	}()
+}
+
+// evictBatch evicts the cached results of the batch. Keys that were cleared or
+// set since are left alone.
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) evictBatch(b *loaderBatch[KeyT, CacheKeyT, ValueT]) {
+	for _, e := range b.entries {
+		s := l.shard(e.cacheKey)
+		s.mu.Lock()
+		if r, ok := s.load(e.cacheKey); ok && r == e.result {
+			s.delete(e.cacheKey)
+		}
+		s.mu.Unlock()
+	}
+}
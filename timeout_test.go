@@ -0,0 +1,116 @@
+package dataloadgen_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchTimeout(t *testing.T) {
+	options := []dataloadgen.Option{
+		dataloadgen.WithWait(time.Millisecond),
+		dataloadgen.WithFetchTimeout(10 * time.Millisecond),
+	}
+	// the first fetch hangs until its context is cancelled and release is
+	// closed, and then returns late
+	lateFirst := func(release, returned chan struct{}) func(ctx context.Context, call int, keys []int) (map[int]string, error) {
+		return func(ctx context.Context, call int, keys []int) (map[int]string, error) {
+			if call == 1 {
+				<-ctx.Done()
+				<-release
+				defer close(returned)
+				return map[int]string{1: "late"}, nil
+			}
+			return map[int]string{1: "retried"}, nil
+		}
+	}
+	// cached returns the number of keys with a result in the cache
+	cached := func(dl *dataloadgen.Loader[int, string]) int {
+		n, err := dl.Export(io.Discard, dataloadgen.JSONSnapshots)
+		require.NoError(t, err)
+		return n
+	}
+
+	t.Run("fails waiting keys and evicts them", func(t *testing.T) {
+		release, returned := make(chan struct{}), make(chan struct{})
+		close(release)
+		dl, fetches := RecordingLoader(lateFirst(release, returned), options...)
+
+		_, err := dl.Load(1)
+		var timeout *dataloadgen.FetchTimeoutError
+		require.ErrorAs(t, err, &timeout)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, 10*time.Millisecond, timeout.Timeout)
+
+		// the key was evicted before the waiter woke up
+		value, err := dl.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "retried", value)
+		require.Len(t, fetches(), 2)
+	})
+
+	t.Run("caches late results", func(t *testing.T) {
+		release, returned := make(chan struct{}), make(chan struct{})
+		dl, fetches := RecordingLoader(lateFirst(release, returned), append(options, dataloadgen.WithLateResults())...)
+
+		_, err := dl.Load(1)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Zero(t, cached(dl))
+		close(release)
+		<-returned
+
+		require.Eventually(t, func() bool {
+			return cached(dl) == 1
+		}, time.Second, time.Millisecond)
+		value, err := dl.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "late", value)
+		require.Len(t, fetches(), 1)
+	})
+
+	t.Run("doesn't cache late errors", func(t *testing.T) {
+		returned := make(chan struct{})
+		dl, fetches := RecordingLoader(func(ctx context.Context, call int, keys []int) (map[int]string, error) {
+			if call == 1 {
+				defer close(returned)
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return map[int]string{1: "retried"}, nil
+		}, append(options, dataloadgen.WithLateResults())...)
+
+		_, err := dl.Load(1)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		<-returned
+		time.Sleep(10 * time.Millisecond)
+		require.Zero(t, cached(dl))
+
+		value, err := dl.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "retried", value)
+		require.Len(t, fetches(), 2)
+	})
+
+	t.Run("late results don't replace keys loaded again", func(t *testing.T) {
+		release, returned := make(chan struct{}), make(chan struct{})
+		dl, fetches := RecordingLoader(lateFirst(release, returned), append(options, dataloadgen.WithLateResults())...)
+
+		_, err := dl.Load(1)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		value, err := dl.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "retried", value)
+
+		close(release)
+		<-returned
+		time.Sleep(10 * time.Millisecond)
+		value, err = dl.Load(1)
+		require.NoError(t, err)
+		require.Equal(t, "retried", value)
+		require.Len(t, fetches(), 2)
+	})
+}
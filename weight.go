@@ -0,0 +1,28 @@
+package dataloadgen
+
+// WithMaxBatchWeight limits batches by the summed weight of their keys, such as
+// the payload size or cost of each key for APIs that limit requests by those
+// rather than by the number of keys. Keys weigh 1 unless SetKeyWeight is used.
+// A batch is sent as soon as adding a key would make its weight exceed max, and
+// the key starts the next batch. A key heavier than max is sent in a batch of
+// its own. This works alongside WithBatchCapacity, whichever limit is hit first
+// closes the batch.
+func WithMaxBatchWeight(max int) Option {
+	return func(l *loaderConfig) {
+		l.maxWeight = max
+	}
+}
+
+// SetKeyWeight sets the function returning the weight of a key, which batches
+// are limited by with WithMaxBatchWeight
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) SetKeyWeight(weight func(key KeyT) int) {
+	l.weight = weight
+}
+
+// keyWeight returns the weight of the key for WithMaxBatchWeight
+func (l *KeyedLoader[KeyT, CacheKeyT, ValueT]) keyWeight(key KeyT) int {
+	if l.weight == nil {
+		return 1
+	}
+	return l.weight(key)
+}
@@ -0,0 +1,63 @@
+package dataloadgen_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mshaeon/dataloadgen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxBatchWeight(t *testing.T) {
+	fetch := func(ctx context.Context, call int, keys []string) (map[string]int, error) {
+		results := make(map[string]int, len(keys))
+		for _, key := range keys {
+			results[key] = len(key)
+		}
+		return results, nil
+	}
+	// every key weighs its length
+	weight := func(key string) int { return len(key) }
+
+	t.Run("closes batches that would exceed the weight", func(t *testing.T) {
+		dl, fetches := RecordingLoader(fetch, dataloadgen.WithMaxBatchWeight(5), dataloadgen.WithWait(10*time.Millisecond))
+		dl.SetKeyWeight(weight)
+		_, errs := dl.LoadAll([]string{"aa", "bb", "cc", "ddddd", "eeeeeeeeee", "f"})
+		require.Nil(t, errs)
+		require.ElementsMatch(t, [][]string{{"aa", "bb"}, {"cc"}, {"ddddd"}, {"eeeeeeeeee"}, {"f"}}, fetches())
+	})
+
+	t.Run("works alongside the count limit", func(t *testing.T) {
+		dl, fetches := RecordingLoader(fetch,
+			dataloadgen.WithMaxBatchWeight(5),
+			dataloadgen.WithBatchCapacity(2),
+			dataloadgen.WithWait(10*time.Millisecond),
+		)
+		dl.SetKeyWeight(weight)
+		_, errs := dl.LoadAll([]string{"a", "b", "c", "dddd", "e"})
+		require.Nil(t, errs)
+		require.ElementsMatch(t, [][]string{{"a", "b"}, {"c", "dddd"}, {"e"}}, fetches())
+	})
+
+	t.Run("per partition", func(t *testing.T) {
+		dl, fetches := RecordingLoader(fetch, dataloadgen.WithWait(10*time.Millisecond))
+		dl.SetKeyWeight(weight)
+		dl.SetPartition(dataloadgen.PartitionBy(func(key string) bool {
+			return strings.HasPrefix(key, "x")
+		}, map[bool][]dataloadgen.Option{
+			true: {dataloadgen.WithMaxBatchWeight(4)},
+		}))
+		_, errs := dl.LoadAll([]string{"xx", "xxx", "aaaaaaa", "bbbbbbbb"})
+		require.Nil(t, errs)
+		require.ElementsMatch(t, [][]string{{"xx"}, {"xxx"}, {"aaaaaaa", "bbbbbbbb"}}, fetches())
+	})
+
+	t.Run("keys weigh 1 by default", func(t *testing.T) {
+		dl, fetches := RecordingLoader(fetch, dataloadgen.WithMaxBatchWeight(2), dataloadgen.WithWait(10*time.Millisecond))
+		_, errs := dl.LoadAll([]string{"aaaa", "bbbb", "cccc"})
+		require.Nil(t, errs)
+		require.ElementsMatch(t, [][]string{{"aaaa", "bbbb"}, {"cccc"}}, fetches())
+	})
+}